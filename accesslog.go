@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Appends what connected peers want from this node to logPath until ctx is done, one tab separated line per event:
+// time, "want", peer ID and CID when a CID shows up in the wantlist of a peer, time, "sent", peer ID and bytes for
+// the data sent to a peer since the previous line. Bitswap doesn't report single sent blocks, so served data is only
+// known per peer and is polled a few times a second, what a peer got right before disconnecting can be missed.
+func LogAccess(ctx context.Context, node *core.IpfsNode, logPath string) error {
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return errors.New("the block exchange of the node is not bitswap")
+	}
+
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	wants := map[peer.ID]map[cid.Cid]bool{}
+	sent := map[peer.ID]uint64{}
+
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		now := time.Now().UTC().Format(time.RFC3339)
+		for _, p := range node.PeerHost.Network().Peers() {
+			current := map[cid.Cid]bool{}
+			for _, c := range bs.WantlistForPeer(p) {
+				current[c] = true
+				if !wants[p][c] {
+					if _, err := fmt.Fprintf(logFile, "%s\twant\t%s\t%s\n", now, p, c); err != nil {
+						return err
+					}
+				}
+			}
+			wants[p] = current
+
+			// the ledger counts from the first exchange with the peer and starts over when it reconnects
+			ledger := bs.LedgerForPeer(p)
+			if ledger == nil {
+				continue
+			}
+			if ledger.Sent < sent[p] {
+				sent[p] = 0
+			}
+			if ledger.Sent > sent[p] {
+				if _, err := fmt.Fprintf(logFile, "%s\tsent\t%s\t%d\n", now, p, ledger.Sent-sent[p]); err != nil {
+					return err
+				}
+				sent[p] = ledger.Sent
+			}
+		}
+	}
+}
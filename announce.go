@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Checks that every value given to the flag called name is a multiaddr, so a typo fails at startup instead of the
+// node silently advertising nothing useful.
+func ValidateMultiaddrs(name string, addrs []string) error {
+	for _, addr := range addrs {
+		if _, err := ma.NewMultiaddr(addr); err != nil {
+			return UsageError{fmt.Errorf("invalid -%s %q: %w", name, addr, err)}
+		}
+	}
+	return nil
+}
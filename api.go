@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	oldcmds "github.com/ipfs/kubo/commands"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/corehttp"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Serves the read-only part of the kubo RPC API of node (cat, get, ls, dag get, ...) at apiAddr, so ipfs compatible
+// clients can use the running node, e.g. ipfs --api /unix/tmp/fsg.sock cat <cid>. With -api-writable all commands are
+// served, add and pin included. Only unix sockets and loopback addresses are accepted, the API has no authentication
+// of its own. On a -repo the address is written to the repo's api file, where other fsg runs on the repo find it
+// instead of failing on the repo lock. The returned func stops the server and removes the socket and api file.
+func ServeApi(ctx context.Context, node *core.IpfsNode, apiAddr string) (func(), error) {
+	addr, err := ma.NewMultiaddr(apiAddr)
+	if err != nil {
+		return nil, UsageError{fmt.Errorf("invalid -api %q, use a multiaddr like /unix/tmp/fsg.sock or /ip4/127.0.0.1/tcp/5001: %w", apiAddr, err)}
+	}
+	if !IsLocalAddr(addr) {
+		return nil, UsageError{fmt.Errorf("-api %s is reachable from other machines, use a unix socket or a loopback address", addr)}
+	}
+
+	listener, err := manet.Listen(addr)
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on -api %s: %w", addr, err)
+	}
+
+	cctx := oldcmds.Context{
+		ReqLog: &oldcmds.ReqLog{},
+		ConstructNode: func() (*core.IpfsNode, error) {
+			return node, nil
+		},
+	}
+	commandsOption := corehttp.CommandsROOption(cctx)
+	if *flagApiWritable {
+		commandsOption = corehttp.CommandsOption(cctx)
+	}
+	go func() {
+		err := corehttp.Serve(node, manet.NetListener(listener), commandsOption, corehttp.CheckVersionOption())
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(output.Status, "\nAPI server stopped: %s\n", err)
+		}
+	}()
+
+	fmt.Fprintf(output.Status, "API listening on %s\n", listener.Multiaddr())
+	if *flagRepo == "" {
+		return func() { listener.Close() }, nil
+	}
+	if err := node.Repo.SetAPIAddr(listener.Multiaddr()); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("could not write the API address into the repo: %w", err)
+	}
+	return func() {
+		os.Remove(filepath.Join(*flagRepo, "api"))
+		listener.Close()
+	}, nil
+}
+
+// Whether addr can only be reached from this machine, a unix socket or a loopback IP.
+func IsLocalAddr(addr ma.Multiaddr) bool {
+	if _, err := addr.ValueForProtocol(ma.P_UNIX); err == nil {
+		return true
+	}
+	return manet.IsIPLoopback(addr)
+}
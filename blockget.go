@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+)
+
+// How long -block-get looks for a block when -block-timeout isn't set.
+const blockGetTimeout = time.Minute
+
+// Fetches only the block of cidStr, without following its links or reading it as a file, and writes its bytes as
+// they are. -o is the file to write to, a directory (like the default) gets the block as <dir>/<cid>.
+func GetBlock(cidStr string) error {
+	c, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+
+	timeout := blockGetTimeout
+	if *flagBlockTimeout > 0 {
+		timeout = *flagBlockTimeout
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	ctx, cancelGet := context.WithTimeout(ctx, timeout)
+	defer cancelGet()
+	r, err := ipfsA.Block().Get(ctx, path.FromCid(c))
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("block %s was not found within %s, no provider sent it (raise -block-timeout to wait longer)", c, timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("could not fetch the block %s: %w", c, err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("could not read the block %s: %w", c, err)
+	}
+
+	outPath := *flagOutput
+	if info, err := os.Stat(outPath); (err == nil && info.IsDir()) || outPath == flag.Lookup("o").DefValue {
+		if err := os.MkdirAll(outPath, 0o755); err != nil {
+			return err
+		}
+		outPath = filepath.Join(outPath, c.String())
+	}
+	if err := os.WriteFile(outPath, data, 0o644); err != nil {
+		return fmt.Errorf("could not write the block: %w", err)
+	}
+	fmt.Fprintf(output.Status, "Wrote the %d bytes of block %s to %s\n", len(data), c, outPath)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	mh "github.com/multiformats/go-multihash"
+)
+
+const (
+	// kubo refuses to put or fetch larger blocks unless told to, other implementations may refuse them outright
+	softBlockLimit = 1 << 20
+	// bitswap doesn't send blocks larger than this, nobody could fetch the block
+	hardBlockLimit = 2 << 20
+)
+
+// Stores the bytes of filePath as one block with the CID codec and hash function given and prints its CID. Nothing is
+// chunked or wrapped, the bytes have to be valid for the codec already. Without a -repo the block is gone on exit,
+// which still tells what CID the bytes have.
+func PutBlock(filePath string, codec string, hashName string, pin bool) error {
+	if pin && *flagRepo == "" {
+		return UsageError{errors.New("-block-pin needs a -repo, pins of a temporary repo are gone on exit")}
+	}
+	if *flagPinName != "" {
+		if !pin {
+			return UsageError{errors.New("-pin-name with -block-put needs -block-pin")}
+		}
+		if err := ValidatePinName(*flagPinName); err != nil {
+			return err
+		}
+	}
+	hashCode, ok := mh.Names[hashName]
+	if !ok {
+		return UsageError{fmt.Errorf("unknown hash function %q, use e.g. sha2-256, sha2-512 or blake3", hashName)}
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	if len(data) > hardBlockLimit {
+		return UsageError{fmt.Errorf("%s is %s, a single block can't be larger than %s, upload it with -f to have it chunked", filePath, humanize.IBytes(uint64(len(data))), humanize.IBytes(hardBlockLimit))}
+	}
+	if len(data) > softBlockLimit {
+		fmt.Fprintf(output.Status, "Warning: %s is %s, larger than the %s most nodes accept for a block, peers may refuse to fetch it\n", filePath, humanize.IBytes(uint64(len(data))), humanize.IBytes(softBlockLimit))
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	stat, err := ipfsA.Block().Put(ctx, bytes.NewReader(data),
+		options.Block.CidCodec(codec),
+		options.Block.Hash(hashCode, -1),
+		options.Block.Pin(pin),
+	)
+	if err != nil {
+		return fmt.Errorf("could not put %s as a block: %w", filePath, err)
+	}
+	c := stat.Path().RootCid()
+	fmt.Fprintf(output.Status, "Stored %s as a %s block of %d bytes:\n%s\n", filePath, codec, stat.Size(), c)
+	if pin {
+		fmt.Fprintf(output.Status, "Pinned %s\n", path.FromCid(c))
+		if *flagPinName != "" {
+			return NamePin(*flagRepo, *flagPinName, c)
+		}
+	}
+	return nil
+}
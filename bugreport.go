@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+
+	ipfs "github.com/ipfs/kubo"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+)
+
+// Flags whose values are never written into a -bug-report: the identity seed is as good as the private key and the
+// remote pinning values can hold access tokens.
+var bugReportSecretFlags = map[string]bool{
+	"identity-seed":  true,
+	"pin-remote":     true,
+	"pin-remote-key": true,
+}
+
+// The modules whose versions go into a -bug-report, next to kubo's own version.
+var bugReportModules = map[string]bool{
+	"github.com/ipfs/boxo":                true,
+	"github.com/libp2p/go-libp2p":         true,
+	"github.com/libp2p/go-libp2p-kad-dht": true,
+}
+
+const redacted = "<redacted>"
+
+// What -bug-report writes. Config and peers are taken from the node right before it stops, so they are missing when
+// the run failed before the node was up.
+type BugReport struct {
+	mu sync.Mutex
+
+	Fsg        string            `json:"fsg"`
+	Go         string            `json:"go"`
+	System     string            `json:"system"`
+	TransferId string            `json:"transferId,omitempty"`
+	Modules    map[string]string `json:"modules"`
+	Flags      map[string]string `json:"flags"`
+	Config     *config.Config    `json:"config,omitempty"`
+	Peers      []string          `json:"peers,omitempty"`
+	Error      string            `json:"error,omitempty"`
+}
+
+var bugReport BugReport
+
+// Remembers the redacted config and the connected peers of node. The swarm key lives in its own file in the repo
+// and is never read for the report.
+func (r *BugReport) Snapshot(node *core.IpfsNode) {
+	if node == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cfg, err := node.Repo.Config(); err == nil {
+		if cfg, err = cfg.Clone(); err == nil {
+			RedactConfig(cfg)
+			r.Config = cfg
+		}
+	}
+
+	r.Peers = nil
+	for _, conn := range node.PeerHost.Network().Conns() {
+		r.Peers = append(r.Peers, fmt.Sprintf("%s %s", conn.RemotePeer(), conn.RemoteMultiaddr()))
+	}
+	sort.Strings(r.Peers)
+}
+
+// Blanks everything in cfg that would let someone act as this node or use its services.
+func RedactConfig(cfg *config.Config) {
+	if cfg.Identity.PrivKey != "" {
+		cfg.Identity.PrivKey = redacted
+	}
+	for name, scope := range cfg.API.Authorizations {
+		if scope != nil && scope.AuthSecret != "" {
+			scope.AuthSecret = redacted
+			cfg.API.Authorizations[name] = scope
+		}
+	}
+	for name, service := range cfg.Pinning.RemoteServices {
+		if service.API.Key != "" {
+			service.API.Key = redacted
+			cfg.Pinning.RemoteServices[name] = service
+		}
+	}
+}
+
+// Writes the report with the versions, the flags that were set and runErr, the error the run ended with, to
+// *flagBugReport.
+func (r *BugReport) Write(runErr error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Fsg = "unknown"
+	r.Go = runtime.Version()
+	r.System = runtime.GOOS + "/" + runtime.GOARCH
+	r.TransferId = transferId
+	r.Modules = map[string]string{"github.com/ipfs/kubo": ipfs.CurrentVersionNumber}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		r.Fsg = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				r.Fsg += " " + setting.Value
+			}
+		}
+		for _, dep := range info.Deps {
+			if bugReportModules[dep.Path] {
+				r.Modules[dep.Path] = dep.Version
+			}
+		}
+	}
+
+	r.Flags = map[string]string{}
+	flag.Visit(func(f *flag.Flag) {
+		if bugReportSecretFlags[f.Name] {
+			r.Flags[f.Name] = redacted
+		} else {
+			r.Flags[f.Name] = f.Value.String()
+		}
+	})
+
+	r.Error = ""
+	if runErr != nil {
+		r.Error = runErr.Error()
+	}
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*flagBugReport, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the bug report: %w", err)
+	}
+	fmt.Fprintf(output.Status, "Wrote a bug report to %s, check it before sharing\n", *flagBugReport)
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Adds every one of filePaths into one directory, named by their base names, without going online and writes the DAG
+// to carPath for handing over offline, the recipient loads it with -import-car. A single file is wrapped like any
+// upload. On a -repo the bundle is also pinned there, otherwise it is added in memory.
+func BundleToCar(filePaths []string, carPath string) error {
+	entries := map[string]files.Node{}
+	for _, filePath := range filePaths {
+		name := filepath.Base(filepath.Clean(filePath))
+		if _, taken := entries[name]; taken {
+			return UsageError{fmt.Errorf("two inputs would be named %q in the bundle, rename one of them", name)}
+		}
+		entry, err := GetUploadEntry(filePath)
+		if err != nil {
+			return err
+		}
+		entries[name] = entry
+	}
+	bundle := files.NewMapDirectory(entries)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a -repo keeps the bundle pinned, otherwise it only has to live until the CAR is written
+	ipfsA, node, err := SpawnOffline(ctx, *flagRepo)
+	if err != nil {
+		return err
+	}
+	// closing flushes the datastore of a -repo
+	defer node.Close()
+
+	root, err := AddOffline(ctx, ipfsA, bundle, options.Unixfs.Pin(*flagRepo != ""))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output.Status, "Bundled %d inputs into\n%s\n", len(filePaths), root)
+
+	written, err := ExportCar(ctx, ipfsA, root.RootCid(), carPath)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", carPath, err)
+	}
+	fmt.Fprintf(output.Status, "Wrote the bundle (%s) to %s, the recipient imports it with -import-car\n", FormatSize(uint64(written)), carPath)
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	car "github.com/ipld/go-car/v2"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+)
+
+// Writes the whole DAG under root into a CARv1 file at carPath, the same format `ipfs dag export` produces. Blocks
+// are fetched through the node, so they come from the network if they aren't local yet.
+func ExportCar(ctx context.Context, ipfsA icore.CoreAPI, root cid.Cid, carPath string) (int64, error) {
+	ls := cidlink.DefaultLinkSystem()
+	ls.TrustedStorage = true
+	ls.StorageReadOpener = func(lctx linking.LinkContext, lnk datamodel.Link) (io.Reader, error) {
+		return ipfsA.Block().Get(lctx.Ctx, path.FromCid(lnk.(cidlink.Link).Cid))
+	}
+
+	f, err := os.OpenFile(carPath, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0o666)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	written, err := car.TraverseV1(ctx, &ls, root, selectorparse.CommonSelector_ExploreAllRecursively, f,
+		car.WithTraversalPrototypeChooser(dagpb.AddSupportToChooser(func(datamodel.Link, linking.LinkContext) (datamodel.NodePrototype, error) {
+			return basicnode.Prototype.Any, nil
+		})))
+	if err != nil {
+		return int64(written), err
+	}
+	return int64(written), f.Close()
+}
+
+// Puts the blocks of the CAR file at carPath that the node doesn't have yet into its blockstore and returns the roots
+// named in its header, how many blocks were imported and how many were skipped because the blockstore had them
+// already. Importing a file again after an interrupted import (or a truncated copy) only adds what is missing. Every
+// block is checked against its CID, a corrupted file fails the import.
+func ImportCar(ctx context.Context, ipfsA icore.CoreAPI, carPath string) (roots []cid.Cid, imported int, skipped int, err error) {
+	f, err := os.Open(carPath)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	defer f.Close()
+
+	reader, err := car.NewBlockReader(f)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("not a valid CAR file: %w", err)
+	}
+	if len(reader.Roots) == 0 {
+		return nil, 0, 0, errors.New("CAR file has no roots")
+	}
+	// an online node would look for a block it doesn't have on the network
+	local, err := ipfsA.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	for {
+		block, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, imported, skipped, fmt.Errorf("block %d: %w", imported+skipped+1, err)
+		}
+		if _, err := local.Block().Stat(ctx, path.FromCid(block.Cid())); err == nil {
+			skipped++
+			continue
+		}
+
+		// keep the CID exactly as it was (version, codec and hash), Block().Put would default to a raw CIDv1
+		keepPrefix := func(settings *options.BlockPutSettings) error {
+			settings.CidPrefix = block.Cid().Prefix()
+			return nil
+		}
+		stat, err := ipfsA.Block().Put(ctx, bytes.NewReader(block.RawData()), keepPrefix)
+		if err != nil {
+			return nil, imported, skipped, err
+		}
+		if !stat.Path().RootCid().Equals(block.Cid()) {
+			return nil, imported, skipped, fmt.Errorf("block %s is corrupted, its data hashes to %s", block.Cid(), stat.Path().RootCid())
+		}
+		imported++
+	}
+
+	return reader.Roots, imported, skipped, nil
+}
+
+// Imports the CAR file at carPath into the node (the -repo one when given), pins all of its roots and prints them.
+// With seed the node keeps serving the imported content afterwards, like an upload does.
+func ImportCarFile(carPath string, seed bool) error {
+	ctx, ipfsA, node, cancel, err := StartIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	roots, imported, skipped, err := ImportCar(ctx, ipfsA, carPath)
+	if err != nil {
+		if imported+skipped > 0 && *flagRepo != "" {
+			fmt.Fprintf(output.Status, "Imported %d blocks before the error, importing the file again skips them\n", imported+skipped)
+		}
+		return fmt.Errorf("could not import %s: %w", carPath, err)
+	}
+	if skipped > 0 {
+		fmt.Fprintf(output.Status, "Imported %d blocks from %s, skipped %d the repo already had\n", imported, carPath, skipped)
+	} else {
+		fmt.Fprintf(output.Status, "Imported %d blocks from %s\n", imported, carPath)
+	}
+
+	fmt.Fprintln(output.Status, "Root CID(s):")
+	complete := true
+	local, err := ipfsA.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		return err
+	}
+	for _, root := range roots {
+		// the pinner fetches missing blocks through the online node and would wait for them forever, so check offline
+		// first that the CAR and the repo hold the whole DAG. The header can even name a root neither of them holds
+		if _, err := CollectDagCids(ctx, local, root); err != nil {
+			complete = false
+			fmt.Fprintf(output.Status, "%s (incomplete: %s)\n", path.FromCid(root), err)
+			continue
+		}
+		err = ipfsA.Pin().Add(ctx, path.FromCid(root), options.Pin.Recursive(true))
+		if err != nil {
+			complete = false
+			fmt.Fprintf(output.Status, "%s (could not pin: %s)\n", path.FromCid(root), err)
+		} else {
+			fmt.Fprintln(output.Status, path.FromCid(root).String())
+		}
+	}
+
+	if seed {
+		if !complete {
+			fmt.Fprintln(output.Status, "Some roots are incomplete, seeding only what was imported")
+		}
+		SeedUntilStopped(ctx, node, nil)
+		fmt.Fprintln(output.Status, "Adios!")
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+
+	"github.com/ipfs/boxo/files"
+)
+
+// Collects the sha256 of every file of an upload while the add reads it, so the files are read only once.
+type Sha256Digests struct {
+	paths   []string
+	hashers map[string]hash.Hash
+}
+
+func NewSha256Digests() *Sha256Digests {
+	return &Sha256Digests{hashers: map[string]hash.Hash{}}
+}
+
+// Returns nd with every file below it hashed as it is read. Paths are relative to nd, the way sha256sum prints them
+// when run inside the uploaded directory.
+func (d *Sha256Digests) Wrap(nd files.Node, name string) files.Node {
+	switch n := nd.(type) {
+	case files.File:
+		h := sha256.New()
+		d.paths = append(d.paths, name)
+		d.hashers[name] = h
+		return &hashingFile{File: n, reader: io.TeeReader(n, h)}
+	case files.Directory:
+		return &hashingDirectory{Directory: n, digests: d, name: name}
+	default:
+		return nd
+	}
+}
+
+// Prints the digests in sha256sum format, in the order the add read the files.
+func (d *Sha256Digests) Print() {
+	for _, name := range d.paths {
+		fmt.Fprintf(output.Status, "%s  %s\n", hex.EncodeToString(d.hashers[name].Sum(nil)), name)
+	}
+}
+
+type hashingFile struct {
+	files.File
+	reader io.Reader
+}
+
+func (f *hashingFile) Read(p []byte) (int, error) {
+	return f.reader.Read(p)
+}
+
+type hashingDirectory struct {
+	files.Directory
+	digests *Sha256Digests
+	name    string
+}
+
+func (d *hashingDirectory) Entries() files.DirIterator {
+	return &hashingIterator{DirIterator: d.Directory.Entries(), digests: d.digests, dir: d.name}
+}
+
+type hashingIterator struct {
+	files.DirIterator
+	digests *Sha256Digests
+	dir     string
+	node    files.Node
+}
+
+func (it *hashingIterator) Next() bool {
+	it.node = nil
+	return it.DirIterator.Next()
+}
+
+// Wraps the current entry only once, even when Node is called again for it.
+func (it *hashingIterator) Node() files.Node {
+	if it.node == nil {
+		it.node = it.digests.Wrap(it.DirIterator.Node(), path.Join(it.dir, it.Name()))
+	}
+	return it.node
+}
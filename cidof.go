@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Prints the CID an upload of filePath would get with the current -layout and -chunker, hashing it on an in-memory
+// node without storing a block or going online. With compareTo (a CID or /ipfs/ path) it checks instead whether
+// filePath has that content, the way -verify-file does, and fails when it doesn't, e.g. to check whether a file was
+// shared already.
+func PrintCidOf(filePath string, compareTo string) error {
+	if compareTo != "" {
+		return VerifyFile(filePath, compareTo)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, node, err := NewMemoryNode(ctx)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	// the same node and options as the upload, the wrapping of single files included, so the CID is the same too
+	someFile, err := GetUploadNode(filePath)
+	if err != nil {
+		return err
+	}
+	added, err := AddOffline(ctx, ipfsA, someFile, options.Unixfs.HashOnly(true))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output.Status, added.RootCid())
+	return nil
+}
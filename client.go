@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/kubo/client/rpc"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/repo/fsrepo"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Returns a client of the node already running on repoPath, an fsg with -api or an ipfs daemon, when that node holds
+// the repo lock and wrote its API address into the repo. Without one ok is false and the repo is opened as usual,
+// failing on the lock if some other process holds it.
+func RunningNodeApi(repoPath string) (api icore.CoreAPI, ok bool, err error) {
+	if repoPath == "" {
+		return nil, false, nil
+	}
+	locked, err := fsrepo.LockedByOtherProcess(repoPath)
+	if err != nil || !locked {
+		return nil, false, err
+	}
+	addr, err := rpc.ApiAddr(repoPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read the API address of the node running on %s: %w", repoPath, err)
+	}
+	httpApi, err := NewApiClient(addr)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not reach the node running on %s: %w", repoPath, err)
+	}
+	fmt.Fprintf(output.Status, "%s is in use by a running node, going through its API\n", repoPath)
+	return httpApi, true, nil
+}
+
+// Returns an RPC client for addr. The kubo client only dials TCP, a unix socket (the -api fsg suggests) needs a
+// transport of its own.
+func NewApiClient(addr ma.Multiaddr) (*rpc.HttpApi, error) {
+	socketPath, err := addr.ValueForProtocol(ma.P_UNIX)
+	if err != nil {
+		return rpc.NewApi(addr)
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	// the host is never looked up, every request goes to the socket
+	return rpc.NewURLApiWithClient("http://fsg-api", &http.Client{Transport: transport})
+}
+
+// Like StartIpfsNode for callers that only need the API: uses the node running on the -repo when there is one and
+// starts a node otherwise.
+func StartOrAttachIpfsNode() (context.Context, icore.CoreAPI, context.CancelFunc, error) {
+	api, ok, err := RunningNodeApi(*flagRepo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		return ctx, api, cancel, nil
+	}
+	ctx, ipfsA, _, cancel, err := StartIpfsNode()
+	return ctx, ipfsA, cancel, err
+}
+
+// Adds and pins filePath through the API of the node running on the -repo, which serves it from then on, so there
+// is nothing left to seed here. That node needs -api-writable for it.
+func UploadThroughApi(api icore.CoreAPI, filePath string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := PrefetchUploadStats(filePath); err != nil {
+		return "", err
+	}
+	someFile, err := GetUploadNode(filePath)
+	if err != nil {
+		return "", err
+	}
+	var digests *Sha256Digests
+	if *flagSha256 {
+		digests = NewSha256Digests()
+		someFile = digests.Wrap(someFile, "")
+	}
+	addOptions, err := UnixfsAddOptions()
+	if err != nil {
+		return "", err
+	}
+	addOptions = append(addOptions, options.Unixfs.Pin(true))
+	added := NewAddProgress()
+	stopTracking := func() {}
+	if *flagVerbose {
+		// the API streams the add events as well, a node that doesn't send them only gets the note below
+		events := make(chan interface{}, 16)
+		addOptions = append(addOptions, options.Unixfs.Progress(true), options.Unixfs.Events(events))
+		trackDone := make(chan struct{})
+		go func() {
+			added.Track(events)
+			close(trackDone)
+		}()
+		stopTracking = func() {
+			close(events)
+			<-trackDone
+		}
+	}
+
+	cidFile, err := api.Unixfs().Add(ctx, someFile, addOptions...)
+	stopTracking()
+	if err != nil {
+		return "", fmt.Errorf("the running node could not add %s (does it serve -api-writable?): %w", filePath, err)
+	}
+	added.NoteMissingEvents()
+	fmt.Fprintf(output.Status, "Added file to IPFS through the running node, it seeds it. Share this CID with your friend:\n%s\n", cidFile.String())
+	if *flagStdoutCid {
+		output.WriteResult([]byte(cidFile.RootCid().String() + "\n"))
+	}
+	if digests != nil {
+		digests.Print()
+	}
+
+	if *flagPinName != "" {
+		if err := NamePin(*flagRepo, *flagPinName, cidFile.RootCid()); err != nil {
+			return "", err
+		}
+	}
+	if *flagSeedFile != "" {
+		if _, err := AddToSeedFile(*flagSeedFile, cidFile.RootCid()); err != nil {
+			return "", fmt.Errorf("could not update the seed file: %w", err)
+		}
+	}
+	return cidFile.String(), nil
+}
+
+// Directories of the kubo RPC client stream their listing once, a second Entries comes back empty. FetchCid looks at
+// the root more than once (wrapper check, -confirm, free space), so for a client every Entries lists again.
+func RelistingNode(ctx context.Context, api icore.CoreAPI, p path.Path, nd files.Node) files.Node {
+	if dir, ok := nd.(files.Directory); ok {
+		return &relistingDirectory{Directory: dir, ctx: ctx, api: api, path: p}
+	}
+	return nd
+}
+
+type relistingDirectory struct {
+	files.Directory
+	ctx  context.Context
+	api  icore.CoreAPI
+	path path.Path
+}
+
+func (d *relistingDirectory) Entries() files.DirIterator {
+	nd, err := d.api.Unixfs().Get(d.ctx, d.path)
+	if err != nil {
+		return &failedIterator{err: err}
+	}
+	dir, ok := nd.(files.Directory)
+	if !ok {
+		return &failedIterator{err: fmt.Errorf("%s is no directory anymore", d.path)}
+	}
+	return &relistingIterator{DirIterator: dir.Entries(), dir: d}
+}
+
+type relistingIterator struct {
+	files.DirIterator
+	dir *relistingDirectory
+}
+
+func (it *relistingIterator) Node() files.Node {
+	p, err := path.Join(it.dir.path, it.Name())
+	if err != nil {
+		return it.DirIterator.Node()
+	}
+	return RelistingNode(it.dir.ctx, it.dir.api, p, it.DirIterator.Node())
+}
+
+type failedIterator struct {
+	err error
+}
+
+func (it *failedIterator) Name() string     { return "" }
+func (it *failedIterator) Node() files.Node { return nil }
+func (it *failedIterator) Next() bool       { return false }
+func (it *failedIterator) Err() error       { return it.err }
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+)
+
+// Makes sure c can be read as a file or directory. dag-pb holds UnixFS files and directories and a raw block is a file
+// of its own bytes, anything else (dag-cbor, dag-json, ...) is structured data the UnixFS reader can't make sense of.
+func CheckFileCodec(c cid.Cid) error {
+	switch c.Type() {
+	case cid.DagProtobuf, cid.Raw:
+		return nil
+	}
+	return fmt.Errorf("%s is %s, not a file or directory; use -dag-get or -links to inspect it", c, multicodec.Code(c.Type()))
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/kubo/repo"
+)
+
+// Returned instead of a node with -dry-run, main exits with ExitOK for it.
+var errDryRun = errors.New("-dry-run: stopped before starting the node")
+
+// Prints the config the node on repoPath is about to start with, the one the repo was created with and the config flags
+// went into, as JSON. Keys are redacted like in a -bug-report, a private network key (swarm.key) is only mentioned.
+func DumpConfig(r repo.Repo, repoPath string) error {
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	cfg, err = cfg.Clone()
+	if err != nil {
+		return err
+	}
+	RedactConfig(cfg)
+	fmt.Fprintf(output.Status, "Config of the repo at %s:\n", repoPath)
+	encoder := json.NewEncoder(output.Status)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(cfg); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(repoPath, "swarm.key")); err == nil {
+		fmt.Fprintf(output.Status, "The repo has a swarm.key, the node only talks to peers of that private network (key not shown)\n")
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/mattn/go-isatty"
+)
+
+var errDownloadDeclined = errors.New("download declined")
+
+// Parallel downloads ask one after the other, the answers would get mixed up otherwise.
+var confirmMutex sync.Mutex
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// Shows how many files and bytes nd holds and asks whether to download them, anything but y or yes declines. Without
+// a terminal on stdin, or with -y, there is nobody to ask and the download goes ahead.
+func ConfirmDownload(nd files.Node) error {
+	fd := os.Stdin.Fd()
+	if *flagYes || !(isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)) {
+		return nil
+	}
+
+	size, err := nd.Size()
+	if err != nil {
+		return err
+	}
+	count, err := CountFiles(nd)
+	if err != nil {
+		return err
+	}
+
+	confirmMutex.Lock()
+	defer confirmMutex.Unlock()
+	fmt.Fprintf(output.Status, "Download %d files, %s? [y/N] ", count, FormatSize(uint64(size)))
+	answer, err := stdinReader.ReadString('\n')
+	if err != nil && answer == "" {
+		return errDownloadDeclined
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+	return errDownloadDeclined
+}
+
+// Returns how many files are below nd, nd itself counts when it is a file. Besides the directories only the first
+// block of every file is fetched for it.
+func CountFiles(nd files.Node) (int, error) {
+	dir, ok := nd.(files.Directory)
+	if !ok {
+		return 1, nil
+	}
+
+	count := 0
+	it := dir.Entries()
+	for it.Next() {
+		n, err := CountFiles(it.Node())
+		if err != nil {
+			return 0, err
+		}
+		count += n
+	}
+	return count, it.Err()
+}
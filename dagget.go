@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	_ "github.com/ipld/go-codec-dagpb"
+	_ "github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	ipldmulticodec "github.com/ipld/go-ipld-prime/multicodec"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multicodec"
+)
+
+// Fetches the block of cidStr and prints it without reading it as a file: decoded as indented dag-json for structured
+// codecs like dag-cbor, dag-json or dag-pb, as a hex dump for raw blocks.
+func PrintDagNode(cidStr string) error {
+	c, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	nd, err := ipfsA.Dag().Get(ctx, c)
+	if err != nil {
+		return fmt.Errorf("could not fetch %s: %w", c, err)
+	}
+
+	if c.Type() == cid.Raw {
+		fmt.Fprint(output.Status, hex.Dump(nd.RawData()))
+		return nil
+	}
+
+	decode, err := ipldmulticodec.LookupDecoder(c.Type())
+	if err != nil {
+		return fmt.Errorf("%s is %s, which fsg can't decode: %w", c, multicodec.Code(c.Type()), err)
+	}
+	builder := basicnode.Prototype.Any.NewBuilder()
+	err = decode(builder, bytes.NewReader(nd.RawData()))
+	if err != nil {
+		return fmt.Errorf("could not decode %s as %s: %w", c, multicodec.Code(c.Type()), err)
+	}
+
+	var encoded, indented bytes.Buffer
+	err = dagjson.Encode(builder.Build(), &encoded)
+	if err != nil {
+		return err
+	}
+	err = json.Indent(&indented, encoded.Bytes(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(output.Status, indented.String())
+	return nil
+}
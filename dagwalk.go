@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/core"
+)
+
+// Fetches every block below root into the repo, with up to concurrency blocks requested at the same time through one
+// bitswap session. The download writer goes entry after entry and asks for few blocks at a time, running this next
+// to it means the writer mostly finds its blocks in the repo already.
+func PrefetchDag(ctx context.Context, node *core.IpfsNode, root cid.Cid, concurrency int) error {
+	session := merkledag.NewSession(ctx, node.DAG)
+	visited := cid.NewSet()
+	return merkledag.Walk(ctx, merkledag.GetLinksWithDAG(session), root, visited.Visit, merkledag.Concurrency(concurrency))
+}
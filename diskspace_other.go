@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// Free space isn't looked up on this platform, downloads then only fail once the disk is actually full.
+func FreeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
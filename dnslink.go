@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/boxo/namesys"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Names can point at other names, give up on chains longer than this like kubo does.
+const maxResolveHops = 32
+
+// Resolves an /ipns/ name, a DNSLink domain like /ipns/docs.ipfs.tech or an IPNS key, to the CID it currently points
+// at. Every hop of the chain is printed, a path below the final CID is resolved too.
+func ResolveName(ctx context.Context, ipfsA icore.CoreAPI, name string) (cid.Cid, error) {
+	fmt.Fprintf(output.Status, "Resolving %s\n", name)
+
+	current := name
+	for hop := 0; hop < maxResolveHops; hop++ {
+		resolved, err := ipfsA.Name().Resolve(ctx, current, options.Name.ResolveOption(namesys.ResolveWithDepth(1)))
+		if err != nil {
+			return cid.Undef, err
+		}
+		fmt.Fprintf(output.Status, "  -> %s\n", resolved)
+		if resolved.Namespace() != path.IPNSNamespace {
+			immutable, _, err := ipfsA.ResolvePath(ctx, resolved)
+			if err != nil {
+				return cid.Undef, err
+			}
+			return immutable.RootCid(), nil
+		}
+		current = resolved.String()
+	}
+	return cid.Undef, errors.New("too many hops, the name may point at itself")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// What a download took, for the line printed when it is done. Providers and duplicates come from bitswap, a client
+// of a node running elsewhere (nil node) only has the bytes and the time.
+type DownloadStats struct {
+	started time.Time
+	node    *core.IpfsNode
+	bs      *bitswap.Bitswap
+	before  *bitswap.Stat
+	// bytes received from each peer before the download, the ledgers count since the node started
+	recvBefore map[peer.ID]uint64
+}
+
+func StartDownloadStats(node *core.IpfsNode) *DownloadStats {
+	s := &DownloadStats{started: time.Now()}
+	if node == nil {
+		return s
+	}
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return s
+	}
+	before, err := bs.Stat()
+	if err != nil {
+		return s
+	}
+	s.node, s.bs, s.before, s.recvBefore = node, bs, before, map[peer.ID]uint64{}
+	for _, p := range node.PeerHost.Network().Peers() {
+		s.recvBefore[p] = s.received(p)
+	}
+	return s
+}
+
+func (s *DownloadStats) received(p peer.ID) uint64 {
+	if receipt := s.bs.LedgerForPeer(p); receipt != nil {
+		return receipt.Recv
+	}
+	return 0
+}
+
+// Returns the summary of a download that wrote written bytes, like "Downloaded 13 MB in 4.2s (3.0 MB/s) from 3
+// provider(s), 5 duplicate blocks (1.3 MB)".
+func (s *DownloadStats) Summary(written int64) string {
+	elapsed := time.Since(s.started)
+	rate := float64(written) / max(elapsed.Seconds(), 0.001)
+	summary := fmt.Sprintf("Downloaded %s in %s (%s/s)", FormatSize(uint64(written)), elapsed.Round(100*time.Millisecond), FormatSize(uint64(rate)))
+	if s.bs == nil {
+		return summary
+	}
+	after, err := s.bs.Stat()
+	if err != nil {
+		return summary
+	}
+
+	providers := 0
+	// bitswap lists only the peers that asked for blocks, the providers are among the connected ones
+	for _, p := range s.node.PeerHost.Network().Peers() {
+		if s.received(p) > s.recvBefore[p] {
+			providers++
+		}
+	}
+	if providers == 0 {
+		summary += " from the local repo"
+	} else {
+		summary += fmt.Sprintf(" from %d provider(s)", providers)
+	}
+	dupBlocks := after.DupBlksReceived - s.before.DupBlksReceived
+	dupData := after.DupDataReceived - s.before.DupDataReceived
+	return summary + fmt.Sprintf(", %d duplicate blocks (%s)", dupBlocks, FormatSize(dupData))
+}
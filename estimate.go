@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/config"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/repo"
+)
+
+// Adds filePath with the current -layout and -chunker to an offline node whose repo only lives in memory, then prints
+// how many blocks that makes and how big they are. Nothing is written to disk or announced, so chunker settings can
+// be compared quickly before the real upload.
+func EstimateUpload(filePath string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, node, err := NewMemoryNode(ctx)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	someFile, err := GetUploadNode(filePath)
+	if err != nil {
+		return err
+	}
+
+	cidFile, err := AddOffline(ctx, ipfsA, someFile)
+	if err != nil {
+		return err
+	}
+
+	links, blockSizes, err := BlockSizes(ctx, ipfsA, cidFile.RootCid())
+	if err != nil {
+		return fmt.Errorf("could not count blocks: %w", err)
+	}
+	var stored uint64
+	for _, size := range blockSizes {
+		stored += uint64(size)
+	}
+
+	fmt.Fprintf(output.Status, "CID: %s\n", cidFile.String())
+	fmt.Fprintf(output.Status, "Blocks: %d (%d unique, identical chunks are stored once)\n", links, len(blockSizes))
+	fmt.Fprintf(output.Status, "Average block size: %s\n", FormatSize(stored/uint64(len(blockSizes))))
+	fmt.Fprintf(output.Status, "Stored size: %s\n", FormatSize(stored))
+	return nil
+}
+
+// Walks the DAG under root and returns how many blocks it references in total, root included, and the size of every
+// distinct block.
+func BlockSizes(ctx context.Context, ipfsA icore.CoreAPI, root cid.Cid) (references int, sizes map[cid.Cid]int, err error) {
+	references = 1
+	sizes = map[cid.Cid]int{}
+	err = WalkDag(ctx, ipfsA, root, func(nd ipld.Node) error {
+		sizes[nd.Cid()] = len(nd.RawData())
+		// a block that is linked more than once is only visited once, its links are still counted once per block
+		references += len(nd.Links())
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return references, sizes, nil
+}
+
+// Spawns an offline node on the -repo at repoPath, or with "" one whose repo only lives in memory, for the commands
+// that add files without sharing them.
+func SpawnOffline(ctx context.Context, repoPath string) (icore.CoreAPI, *core.IpfsNode, error) {
+	if repoPath == "" {
+		return NewMemoryNode(ctx)
+	}
+	return SpawnPersistent(ctx, repoPath, false)
+}
+
+// Adds nd to the offline node ipfsA like an upload would, with the current -layout and -chunker. Options in
+// addOptions are applied after those and win over them.
+func AddOffline(ctx context.Context, ipfsA icore.CoreAPI, nd files.Node, addOptions ...options.UnixfsAddOption) (path.ImmutablePath, error) {
+	uploadOptions, err := UnixfsAddOptions()
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	return ipfsA.Unixfs().Add(ctx, nd, append(uploadOptions, addOptions...)...)
+}
+
+// Returns an offline node whose repo only lives in memory, nothing it adds touches the disk or the network.
+func NewMemoryNode(ctx context.Context) (icore.CoreAPI, *core.IpfsNode, error) {
+	if err := SetupPluginsOnce(); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := config.Init(io.Discard, 2048)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online: false,
+		Repo: &repo.Mock{
+			C: *cfg,
+			D: dssync.MutexWrap(datastore.NewMapDatastore()),
+			K: keystore.NewMemKeystore(),
+		},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create in-memory node: %w", err)
+	}
+
+	ipfsA, err := coreapi.NewCoreAPI(node)
+	if err != nil {
+		node.Close()
+		return nil, nil, err
+	}
+	return ipfsA, node, nil
+}
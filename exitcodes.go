@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/ipfs/boxo/namesys"
+	lockfile "github.com/ipfs/go-fs-lock"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+)
+
+// Exit codes, so scripts can tell what went wrong without parsing the output.
+const (
+	ExitOK         = 0
+	ExitFailure    = 1 // anything not covered below
+	ExitUsage      = 2 // invalid flags or arguments
+	ExitNotFound   = 3 // the content or name couldn't be found in time
+	ExitNetwork    = 4 // peers couldn't be dialed
+	ExitDisk       = 5 // writing to disk failed, e.g. it is full or read-only
+	ExitRepoLocked = 6 // another process is using the -repo
+)
+
+// Help text for the exit codes above.
+const exitCodesHelp = `Exit codes:
+  0  success
+  1  any other failure
+  2  invalid flags or arguments
+  3  content or name not found, or a timeout
+  4  network or dial failure
+  5  disk or write failure
+  6  the repo is locked by another process
+`
+
+// Marks an error as caused by the flags or arguments that were passed, main exits with ExitUsage for it.
+type UsageError struct {
+	error
+}
+
+func (e UsageError) Unwrap() error {
+	return e.error
+}
+
+// Returns the exit code for err, see the Exit* constants.
+func ExitCode(err error) int {
+	var usageErr UsageError
+	var lockedErr lockfile.LockedError
+	var dialErr *swarm.DialError
+	var netErr *net.OpError
+	switch {
+	case err == nil, errors.Is(err, errDryRun):
+		return ExitOK
+	case errors.As(err, &usageErr):
+		return ExitUsage
+	case errors.As(err, &lockedErr):
+		return ExitRepoLocked
+	case errors.Is(err, syscall.ENOSPC), errors.Is(err, syscall.EDQUOT), errors.Is(err, syscall.EROFS),
+		errors.Is(err, syscall.EIO), errors.Is(err, fs.ErrPermission):
+		return ExitDisk
+	case errors.Is(err, context.DeadlineExceeded), ipld.IsNotFound(err), errors.Is(err, routing.ErrNotFound),
+		errors.Is(err, namesys.ErrResolveFailed):
+		return ExitNotFound
+	case errors.As(err, &dialErr), errors.As(err, &netErr), errors.Is(err, swarm.ErrDialBackoff),
+		errors.Is(err, swarm.ErrNoAddresses), errors.Is(err, swarm.ErrNoGoodAddresses):
+		return ExitNetwork
+	}
+	return ExitFailure
+}
+
+// Prints err, writes it into the -bug-report if one was asked for and exits with its exit code.
+func Exit(err error) {
+	fmt.Fprintln(output.Status, err)
+	if *flagBugReport != "" {
+		if reportErr := bugReport.Write(err); reportErr != nil {
+			fmt.Fprintln(output.Status, reportErr)
+		}
+	}
+	os.Exit(ExitCode(err))
+}
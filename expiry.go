@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+)
+
+// Query parameter of a share link that carries the -share-expiry, e.g. /ipfs/<cid>?expires=2024-05-01T15:04:05Z.
+const expiryHintKey = "expires"
+
+// When seeding of the upload stops for -share-expiry, zero without one.
+var shareUntil time.Time
+
+// Returns p as a share link with until as expiry hint. The hint is only informational, fsg downloads strip it and
+// other tools ignore it.
+func ShareLink(p path.Path, until time.Time) string {
+	// a timestamp needs no escaping in a query, left as it is it stays readable
+	return p.String() + "?" + expiryHintKey + "=" + until.UTC().Format(time.RFC3339)
+}
+
+// Returns the expiry hint of a share link, ok is false when there is none or it can't be read.
+func ShareExpiryHint(link string) (until time.Time, ok bool) {
+	_, query, found := strings.Cut(strings.TrimSpace(link), "?")
+	if !found {
+		return time.Time{}, false
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return time.Time{}, false
+	}
+	until, err = time.Parse(time.RFC3339, values.Get(expiryHintKey))
+	return until, err == nil
+}
+
+// Tells the downloader how long the sharer meant to seed, or that the share has expired and the content may be gone.
+func PrintShareExpiry(link string) {
+	until, ok := ShareExpiryHint(link)
+	if !ok {
+		return
+	}
+	if time.Now().After(until) {
+		fmt.Fprintf(output.Status, "The share expired at %s, the sharer may not seed it anymore\n", until.Local().Format(time.DateTime))
+	} else {
+		fmt.Fprintf(output.Status, "Shared until %s\n", until.Local().Format(time.DateTime))
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const helpExamples = `Examples:
+  fsg -f example.jpg                      share a file or directory, keep it running while others download
+  fsg -c /ipfs/QmX4zdEU...                download into Download/<cid>
+  fsg -c QmA... QmB... -o ~/shared        download several CIDs at once into ~/shared
+  fsg -repo ~/.fsg -f example.jpg         keep blocks, pins and keys between runs
+`
+
+// Flags shown together in the help, in this order. Flags missing here end up under "Other".
+var helpGroups = []struct {
+	title string
+	flags []string
+}{
+	{"Upload", []string{"f", "layout", "chunker", "estimate", "cid-of", "verify-file", "max-file-size", "include-hidden", "modified-since", "parallel-add-files", "sha256", "stdout-cid", "v", "watch", "publish", "publish-key", "seed-duration", "idle-timeout", "share-expiry", "access-log", "pin-remote", "pin-remote-key"}},
+	{"Download", []string{"c", "strict", "o", "output-name-from-cid", "flatten", "rename", "manifest-out", "workers", "max-depth", "add-ext", "car", "check-space", "providers", "check-providers", "providers-timeout", "stall-timeout", "block-timeout", "dag-concurrency", "prefetch", "quiet", "tree", "links", "to-memory", "max-memory", "minimal-blockstore", "dag-get", "block-get", "mount", "monitor", "interval"}},
+	{"Network", []string{"peers-file", "no-bootstrap", "bootstrap-interval", "connect-timeout", "agent", "content-routing", "mdns", "listen", "announce", "no-announce", "swarm-filter", "fast-dht", "low-power", "mem-limit", "identity-seed"}},
+	{"Repo and advanced", []string{"repo", "repo-migrate", "repo-repair", "keep-temp", "keys", "import", "import-car", "seed", "seed-car", "seed-file", "unseed", "verify-interval", "block-put", "block-codec", "block-hash", "block-pin", "pin", "pin-name", "pins", "unpin", "api", "api-writable", "experimental", "progress", "progress-unit", "raw-size", "timing", "config-dump", "dry-run", "bug-report", "json-progress", "transfer-id", "selftest", "list-plugins"}},
+}
+
+// Prints the help: examples, the flags grouped by what they are for and the exit codes. Used as flag.Usage, so it
+// shows for -h and for invalid flags.
+func PrintHelp() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: fsg [flags] -f <file or directory> | -c <cid> [more cids]\n\n%s", helpExamples)
+
+	grouped := map[string]bool{}
+	for _, group := range helpGroups {
+		fmt.Fprintf(out, "\n%s:\n", group.title)
+		for _, name := range group.flags {
+			if f := flag.Lookup(name); f != nil {
+				PrintFlag(out, f)
+				grouped[name] = true
+			}
+		}
+	}
+
+	var other []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		if !grouped[f.Name] {
+			other = append(other, f)
+		}
+	})
+	if len(other) > 0 {
+		fmt.Fprint(out, "\nOther:\n")
+		for _, f := range other {
+			PrintFlag(out, f)
+		}
+	}
+
+	fmt.Fprint(out, "\n"+exitCodesHelp)
+}
+
+// Prints a single flag the way flag.PrintDefaults does.
+func PrintFlag(out io.Writer, f *flag.Flag) {
+	name, usage := flag.UnquoteUsage(f)
+	line := "  -" + f.Name
+	if name != "" {
+		line += " " + name
+	}
+	// short names fit on the same line as their usage
+	if len(line) <= 4 {
+		line += "\t"
+	} else {
+		line += "\n    \t"
+	}
+	line += strings.ReplaceAll(usage, "\n", "\n    \t")
+
+	switch f.DefValue {
+	case "", "false", "0", "0s", "[]":
+	default:
+		if getter, ok := f.Value.(flag.Getter); ok && isString(getter.Get()) {
+			line += fmt.Sprintf(" (default %q)", f.DefValue)
+		} else {
+			line += fmt.Sprintf(" (default %v)", f.DefValue)
+		}
+	}
+	fmt.Fprintln(out, line)
+}
+
+func isString(value any) bool {
+	_, ok := value.(string)
+	return ok
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/ipfs/kubo/config"
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Derives an Ed25519 node identity from seed, the same seed always gives the same peer ID. Anyone who knows the seed
+// can derive the private key too and impersonate the node, so treat it like a password.
+func IdentityFromSeed(seed string) (config.Identity, error) {
+	hash := sha256.Sum256([]byte(seed))
+	privKey, err := crypto.UnmarshalEd25519PrivateKey(ed25519.NewKeyFromSeed(hash[:]))
+	if err != nil {
+		return config.Identity{}, err
+	}
+
+	id, err := peer.IDFromPrivateKey(privKey)
+	if err != nil {
+		return config.Identity{}, err
+	}
+
+	privKeyBytes, err := crypto.MarshalPrivateKey(privKey)
+	if err != nil {
+		return config.Identity{}, err
+	}
+
+	return config.Identity{
+		PeerID:  id.String(),
+		PrivKey: base64.StdEncoding.EncodeToString(privKeyBytes),
+	}, nil
+}
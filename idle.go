@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	"github.com/ipfs/kubo/core"
+)
+
+// Returns a channel that is closed once node has served no block for timeout, checked a few times per timeout but at
+// least every minute. Seeding starts the clock, a node nobody fetches from stops after timeout as well. Returns nil,
+// which never fires, when node has no bitswap to watch.
+func IdleTimeout(ctx context.Context, node *core.IpfsNode, timeout time.Duration) <-chan struct{} {
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return nil
+	}
+	interval := min(max(timeout/4, time.Second), time.Minute)
+
+	idle := make(chan struct{})
+	go func() {
+		var lastSent uint64
+		if stat, err := bs.Stat(); err == nil {
+			lastSent = stat.BlocksSent
+		}
+		lastActive := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if stat, err := bs.Stat(); err == nil && stat.BlocksSent != lastSent {
+				lastSent = stat.BlocksSent
+				lastActive = time.Now()
+				continue
+			}
+			if time.Since(lastActive) >= timeout {
+				close(idle)
+				return
+			}
+		}
+	}()
+	return idle
+}
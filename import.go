@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Adds filePath to the persistent repo and pins it without ever going online, for ingesting content that a daemon
+// on the same repo serves later. When a node is already running on the repo it adds through that node's API instead.
+// Prints the CID and how many blocks the DAG has.
+func ImportFiles(repoPath string, filePath string) (cidStr string, err error) {
+	if repoPath == "" {
+		return "", UsageError{errors.New("-import needs a persistent repo to import into, pass one with -repo")}
+	}
+	if *flagPinName != "" {
+		if err := ValidatePinName(*flagPinName); err != nil {
+			return "", err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, ok, err := RunningNodeApi(repoPath)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		var node *core.IpfsNode
+		ipfsA, node, err = SpawnPersistent(ctx, repoPath, false)
+		if err != nil {
+			return "", fmt.Errorf("failed to spawn node: %w", err)
+		}
+		// closing flushes the datastore, without it the last blocks might not make it to disk
+		defer func() {
+			if closeErr := node.Close(); err == nil {
+				err = closeErr
+			}
+		}()
+	}
+
+	someFile, err := GetUploadNode(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	addOptions, err := UnixfsAddOptions()
+	if err != nil {
+		return "", err
+	}
+	addOptions = append(addOptions, options.Unixfs.Pin(true))
+
+	cidFile, err := ipfsA.Unixfs().Add(ctx, someFile, addOptions...)
+	if err != nil {
+		return "", err
+	}
+
+	blocks, err := CollectDagCids(ctx, ipfsA, cidFile.RootCid())
+	if err != nil {
+		return "", fmt.Errorf("could not count blocks: %w", err)
+	}
+
+	fmt.Fprintf(output.Status, "Imported and pinned %s\n", cidFile.String())
+	if *flagPinName != "" {
+		if err := NamePin(repoPath, *flagPinName, cidFile.RootCid()); err != nil {
+			return "", err
+		}
+	}
+	fmt.Fprintf(output.Status, "Blocks: %d\n", len(blocks))
+
+	return cidFile.String(), nil
+}
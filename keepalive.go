@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/boxo/bootstrap"
+	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// How often a seeding node checks that it still has peers, unless -bootstrap-interval sets it.
+const keepaliveInterval = 10 * time.Second
+
+// Once connected, -bootstrap-interval checks less and less often, up to this.
+const maxBootstrapBackoff = 10 * time.Minute
+
+// The bootstrap settings of the node, with -connect-timeout per dial when it is set.
+func BootstrapConfig() bootstrap.BootstrapConfig {
+	cfg := bootstrap.DefaultBootstrapConfig
+	if *flagConnectTimeout > 0 {
+		cfg.ConnectionTimeout = *flagConnectTimeout
+	}
+	return cfg
+}
+
+// Watches the connections of node until ctx is done. When the last peer is gone, e.g. after the network was down for
+// a while, it dials the bootstrap peers of the repo config and the -peers-file peers again and logs whether that
+// worked, so a home seeder becomes reachable again on its own. Without -bootstrap-interval it checks every
+// keepaliveInterval, once the node had peers. With it the checks start right away, for a node started before the
+// network was up (right after boot, before the VPN), every attempt is printed and while connected the checks back
+// off, doubling up to maxBootstrapBackoff, and start over at the interval when the node loses all peers.
+func KeepConnected(ctx context.Context, node *core.IpfsNode) {
+	interval := keepaliveInterval
+	retryFromStart := *flagBootstrapInterval > 0
+	if retryFromStart {
+		interval = *flagBootstrapInterval
+	}
+
+	// without -bootstrap-interval a node that never had peers is offline by choice or has no network at all
+	hadPeers := false
+	disconnected := false
+	attempt := 0
+	wait := interval
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if len(node.PeerHost.Network().Peers()) > 0 {
+			hadPeers = true
+			disconnected = false
+			if retryFromStart {
+				wait = min(wait*2, maxBootstrapBackoff)
+			}
+			continue
+		}
+		wait = interval
+		if !hadPeers && !retryFromStart {
+			continue
+		}
+
+		attempt++
+		switch {
+		case retryFromStart:
+			fmt.Fprintf(output.Status, "\nNo peers connected, connecting to the bootstrap peers again (attempt %d, next check in %s)\n", attempt, interval)
+		case !disconnected:
+			fmt.Fprintln(output.Status, "\nLost all peers, connecting to the bootstrap peers again")
+		}
+		disconnected = true
+
+		connected := Rebootstrap(ctx, node)
+		if connected > 0 {
+			fmt.Fprintf(output.Status, "\nReconnected to %d peer(s)\n", connected)
+			disconnected = false
+			attempt = 0
+		}
+	}
+}
+
+// Dials the bootstrap peers and the -peers-file peers, returns how many connections succeeded.
+func Rebootstrap(ctx context.Context, node *core.IpfsNode) int {
+	var peers []peer.AddrInfo
+	cfg, err := node.Repo.Config()
+	if err == nil {
+		bootstrapPeers, err := cfg.BootstrapPeers()
+		if err == nil {
+			peers = append(peers, bootstrapPeers...)
+		}
+	}
+	if *flagPeersFile != "" {
+		filePeers, err := LoadPeersFile(*flagPeersFile)
+		if err == nil {
+			peers = append(peers, filePeers...)
+		}
+	}
+
+	connected := 0
+	for _, p := range peers {
+		dialCtx, cancel := context.WithTimeout(ctx, BootstrapConfig().ConnectionTimeout)
+		if node.PeerHost.Connect(dialCtx, p) == nil {
+			connected += 1
+		}
+		cancel()
+	}
+	return connected
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/kubo/core"
+	icore "github.com/ipfs/kubo/core/coreiface"
+)
+
+// Runs the -keys subcommand against the persistent repo: list, gen <name> or rm <name>. Keys of a temporary repo are
+// thrown away on exit, so a -repo is required.
+func ManageKeys(repoPath string, command string, name string) error {
+	if repoPath == "" {
+		return UsageError{errors.New("-keys needs a persistent repo, pass one with -repo")}
+	}
+	if command != "list" {
+		if err := ValidateKeyName(name); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, ok, err := RunningNodeApi(repoPath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// keys live in the repo keystore, there is no need to go online for them
+		var node *core.IpfsNode
+		ipfsA, node, err = SpawnPersistent(ctx, repoPath, false)
+		if err != nil {
+			return fmt.Errorf("failed to spawn node: %w", err)
+		}
+		defer node.Close()
+	}
+
+	switch command {
+	case "list":
+		keys, err := ipfsA.Key().List(ctx)
+		if err != nil {
+			return fmt.Errorf("could not list keys: %w", err)
+		}
+		for _, key := range keys {
+			PrintKey(key)
+		}
+	case "gen":
+		key, err := ipfsA.Key().Generate(ctx, name)
+		if err != nil {
+			return fmt.Errorf("could not generate key %q: %w", name, err)
+		}
+		PrintKey(key)
+	case "rm":
+		if name == "self" {
+			return UsageError{errors.New("the self key is the identity of the node and can't be removed")}
+		}
+		key, err := ipfsA.Key().Remove(ctx, name)
+		if err != nil {
+			return fmt.Errorf("could not remove key %q: %w", name, err)
+		}
+		fmt.Fprintf(output.Status, "Removed key %s %s\n", name, key.Path().String())
+	default:
+		return UsageError{fmt.Errorf("unknown -keys command %q, use list, gen <name> or rm <name>", command)}
+	}
+
+	return nil
+}
+
+func PrintKey(key icore.Key) {
+	fmt.Fprintf(output.Status, "%s %s\n", key.Name(), key.Path().String())
+}
+
+// Key names end up as file names in the keystore, so keep them to something every filesystem accepts.
+func ValidateKeyName(name string) error {
+	if name == "" {
+		return UsageError{errors.New("missing key name, pass it after the flags e.g. -keys gen mykey")}
+	}
+	if strings.ContainsAny(name, `/\:*?"<>| `) || strings.HasPrefix(name, ".") {
+		return UsageError{fmt.Errorf("invalid key name %q", name)}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Fetches only the root block of cidStr and prints its links: child CID, size in bytes and name. Unlike the UnixFS
+// listing this shows how a file was chunked, and it works for any codec (raw blocks simply have no links).
+func PrintLinks(cidStr string) error {
+	rootCid, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	nd, err := ipfsA.Dag().Get(ctx, rootCid)
+	if err != nil {
+		return fmt.Errorf("could not fetch %s: %w", rootCid, err)
+	}
+
+	links := nd.Links()
+	fmt.Fprintf(output.Status, "%s has %d link(s)\n", rootCid, len(links))
+	for _, link := range links {
+		fmt.Fprintf(output.Status, "%s %d %s\n", link.Cid, link.Size, link.Name)
+	}
+	return nil
+}
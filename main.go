@@ -1,48 +1,155 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/dustin/go-humanize"
+	"github.com/gabriel-vasile/mimetype"
 	"github.com/ipfs/boxo/files"
 	"github.com/ipfs/boxo/path"
 	"github.com/ipfs/go-cid"
+	ipfs "github.com/ipfs/kubo"
 	"github.com/ipfs/kubo/config"
 	"github.com/ipfs/kubo/core"
 	"github.com/ipfs/kubo/core/coreapi"
 	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
 	"github.com/ipfs/kubo/core/node/libp2p"
 	"github.com/ipfs/kubo/plugin/loader"
 	"github.com/ipfs/kubo/repo/fsrepo"
-	"github.com/schollz/progressbar/v3"
+	"github.com/ipfs/kubo/repo/fsrepo/migrations"
+	"github.com/libp2p/go-libp2p/core/peer"
 )
 
 var flagExp = flag.Bool("experimental", false, "enable experimental features")
+var flagFastDht = flag.Bool("fast-dht", false, "use the accelerated DHT client for much faster provider lookups, at the cost of a slower start and more memory and connections (needs -experimental)")
+var flagMemLimit = flag.String("mem-limit", "", "soft memory cap like 512MB for small devices: the Go GC works harder near it and connections and bitswap buffers are sized down (the config part when the repo is created)")
+var flagMdns = flag.Bool("mdns", true, "find and connect to fsg and ipfs nodes on the local network over mDNS and print them (applied when the repo is created)")
+var flagLowPower = flag.Bool("low-power", false, "keep background work low for laptops on battery: DHT client mode, fewer connections, no reproviding and no AutoNAT service")
+var flagListen = flag.Bool("listen", true, "accept inbound connections, with false the node only dials out and advertises no addresses (meant for downloads)")
+var flagNoBootstrap = flag.Bool("no-bootstrap", false, "don't contact the default bootstrap nodes, only the peers from -peers-file (for isolated setups)")
+var flagContentRouting = flag.String("content-routing", "dht", "how content and peers are found: dht, or none to only find peers on the local network through mDNS (no WAN traffic)")
+var flagPeersFile = flag.String("peers-file", "", "file with one peer multiaddr per line to connect to on startup (# starts a comment)")
+var flagIdentitySeed = flag.String("identity-seed", "", "derive the node key from this string so the peer ID is the same every run (anyone knowing the seed has the private key)")
+var flagSwarmFilters = StringListFlag("swarm-filter", "never dial this CIDR range, or with a leading ! only dial this range (repeatable)")
+var flagAnnounce = StringListFlag("announce", "advertise this multiaddr instead of the detected ones, e.g. /ip4/<public ip>/tcp/4001 behind port forwarding (repeatable)")
+var flagNoAnnounce = StringListFlag("no-announce", "never advertise this multiaddr, or a range of them like /ip4/10.0.0.0/ipcidr/8 (repeatable)")
+var flagRepo = flag.String("repo", "", "use a persistent IPFS repo at this path instead of a temporary one (created if missing)")
+var flagRepoMigrate = flag.Bool("repo-migrate", false, "migrate a -repo created by an older fsg to the current repo version (downloads the migration tools)")
+var flagRepoRepair = flag.Bool("repo-repair", false, "complete a -repo left partially initialized by an interrupted first run, keeping what is there")
+var flagMinimalBlockstore = flag.Bool("minimal-blockstore", false, "download without any repo on disk, the blocks are kept in memory and only the downloaded files are written (for small downloads)")
+var flagKeepTemp = flag.Bool("keep-temp", false, "don't remove the temporary repo on exit and print its path, to inspect blocks, config and logs after a failed run")
+var flagCheckProviders = flag.Bool("check-providers", false, "only look up how many peers provide the CID, without downloading")
+var flagProviders = flag.Int("providers", 0, "before downloading, look up at most this many providers and connect to them, the lookup stops once that many are found (0 = leave it to bitswap)")
+var flagAgent = flag.String("agent", "", "add this to the user agent other peers see through identify, e.g. fsg/1.2.3 (kubo/<version>/ stays in front of it)")
+var flagBootstrapInterval = flag.Duration("bootstrap-interval", 0, "while no peer is connected, dial the bootstrap and -peers-file peers again this often from the start, e.g. 15s, backing off once connected (0 = every 10s while seeding, once the node had peers)")
+var flagConnectTimeout = flag.Duration("connect-timeout", 0, "give up dialing a -peers-file peer, a provider or a bootstrap node after this long, e.g. 5s (0 = kubo's defaults)")
+var flagProvidersTimeout = flag.Duration("providers-timeout", 30*time.Second, "how long to search for providers with -check-providers or -providers")
+var flagMaxFileSize = flag.String("max-file-size", "", "refuse to upload a file, or a directory in total, bigger than this, e.g. 2GB (empty = no limit)")
+var flagModifiedSince = flag.String("modified-since", "", "only upload the files of a directory modified after this, a duration back from now like 24h or a time like 2024-05-01")
+var flagChunker = flag.String("chunker", "", "how uploads are split into blocks, e.g. size-1048576 or rabin-262144-524288-1048576 (default size-262144, changes the CID)")
+var flagIncludeHidden = flag.Bool("include-hidden", false, "also upload files and directories whose name starts with a dot, like .env or .git, which are left out otherwise")
+var flagManifestOut = flag.String("manifest-out", "", "after a download, write a JSON manifest of the root CID, total size and every file written with its path, size and CID to this file")
+var flagWatch = flag.Bool("watch", false, "while seeding, watch -f for changes and add it again once they settle, printing each new CID")
+var flagPublish = flag.Bool("publish", false, "publish the uploaded CID (with -watch every new one) to IPNS under -publish-key, so one /ipns/ link always points at the latest version")
+var flagPublishKey = flag.String("publish-key", "self", "name of the -repo key whose IPNS name -publish updates, see -keys")
+var flagParallelAddFiles = flag.Int("parallel-add-files", 0, "before adding a directory, stat its files this many at a time to warm the file system cache and size the progress bar, speeds up adds from NFS or SMB (0 = off)")
+var flagSha256 = flag.Bool("sha256", false, "while uploading, also compute the sha256 of every file and print it next to the CID (in sha256sum format)")
+var flagLayout = flag.String("layout", "balanced", "UnixFS DAG layout used for uploads: balanced or trickle (trickle suits streaming, but gives a different CID)")
+var flagPinName = flag.String("pin-name", "", "label the pin of an upload, -import or -pin in the -repo with this name, -pins lists the names")
+var flagPinRemote = flag.String("pin-remote", "", "after uploading, pin the CID on this remote pinning service (endpoint URL or service name from the -repo config)")
+var flagPinRemoteKey = flag.String("pin-remote-key", "", "access token for a -pin-remote endpoint URL (or set FSG_PIN_REMOTE_KEY)")
+var flagVerifyInterval = flag.Duration("verify-interval", 0, "while seeding, re-read and re-hash every block of the pinned content this often, e.g. 24h, and report corrupt or missing blocks (0 = never)")
+var flagShareExpiry = flag.Duration("share-expiry", 0, "stop seeding an upload after this long, e.g. 48h, and tell recipients: prints \"available until\" and adds ?expires= to the share link")
+var flagSeedDuration = flag.Duration("seed-duration", 0, "stop seeding and exit after this long, e.g. 1h (0 = seed until interrupted)")
+var flagIdleTimeout = flag.Duration("idle-timeout", 0, "stop seeding and exit once no block was served for this long, e.g. 30m, for a supervisor to start fsg again on demand (0 = never)")
+var flagAccessLog = flag.String("access-log", "", "while seeding, append the CIDs peers ask for and the bytes sent to each of them to this file")
+var flagStallTimeout = flag.Duration("stall-timeout", time.Minute, "search for providers again when a download received nothing for this long (0 = never)")
+var flagBlockTimeout = flag.Duration("block-timeout", 0, "when a single block of a download takes longer than this, look for other providers of it, e.g. 30s (0 = never)")
+var flagDagConcurrency = flag.Int("dag-concurrency", 8, "how many blocks a download requests at the same time ahead of writing, more is faster for wide directories on good connections but costs bandwidth and memory (1 = only what is being written)")
+var flagSeedCar = flag.String("seed-car", "", "seed the blocks of this CAR file straight from the file, without importing them into a repo")
+var flagSeedFile = flag.String("seed-file", "", "keep a list of the CIDs seeded from the -repo in this file: uploads are added to it and announced again together with it, without -f or -c everything listed is seeded")
+var flagApi = flag.String("api", "", "serve the read-only kubo RPC API of the running node here for ipfs compatible clients, a unix socket like /unix/tmp/fsg.sock or a loopback multiaddr like /ip4/127.0.0.1/tcp/5001")
+var flagApiWritable = flag.Bool("api-writable", false, "serve all of the -api, add and pin included, so other fsg runs on the same -repo can upload through this node")
+var flagCar = flag.String("car", "", "when downloading, export the DAG into this CAR file instead of writing the files; with -f, add the inputs offline and write them into it")
+var flagProgress = flag.Bool("progress", true, "draw progress bars and spinners, they are left out anyway when stderr is not a terminal")
+var flagStdoutCid = flag.Bool("stdout-cid", false, "when uploading, print only the bare CID to stdout, everything else goes to stderr")
+var flagRawSize = flag.Bool("raw-size", false, "print sizes as exact byte counts like 4213742 B instead of 4.2 MB, for scripts")
+var flagTiming = flag.Bool("timing", false, "print how long each phase took at the end: node startup, add and provide, or provider lookup, first byte and fetch")
+var flagConfigDump = flag.Bool("config-dump", false, "print the config the node starts with as JSON, with the config flags applied and keys redacted")
+var flagDryRun = flag.Bool("dry-run", false, "stop right before the node starts, e.g. to only see -config-dump")
+var flagBugReport = flag.String("bug-report", "", "write versions, the redacted config, connected peers and the last error to this file when the run ends, to attach to an issue")
+var flagProgressUnit = flag.String("progress-unit", "bytes", "count upload and download progress in bytes or blocks (blocks added, or received from peers)")
+var flagTransferId = flag.String("transfer-id", "", "start every line fsg prints with [<id>] and add the id to -json-progress events and -bug-report, to group the logs of many fsg runs (auto = a random UUID)")
+var flagJsonProgress = flag.Bool("json-progress", false, "instead of progress bars, write progress, peer, status and done events as JSON lines to stderr")
+var flagOutput = flag.String("o", "Download", "directory to write downloads into, every CID ends up in <dir>/<cid>")
+var flagOutputNameFromCid = flag.Bool("output-name-from-cid", true, "name downloads after their CID, with false a CID wrapping a single file or directory is written under that entry's name")
+var flagQuiet = flag.Bool("quiet", false, "don't print the summary line (size, time, rate, providers, duplicate blocks) after a download")
+var flagVerbose = flag.Bool("v", false, "while uploading, print every file when it is hashed and with its CID once it is added (progress is printed as lines then)")
+var flagStrict = flag.Bool("strict", false, "only download inputs that are exactly a CID or an /ipfs/<cid> or /ipns/<name> path, instead of picking the CID out of whatever was given")
+var flagPrefetch = flag.Bool("prefetch", false, "fetch all blocks of a download into the repo first and write the files afterwards, each with its own progress, for slow disks or to tell network and disk stalls apart")
+var flagFlatten = flag.Bool("flatten", false, "unwrap a CID wrapping a single entry: a wrapped directory's entries go right into the output directory of the CID, a wrapped file (what fsg -f uploads of single files are) is written into -o directly")
+var flagConfirm = flag.Bool("confirm", false, "before downloading, show the number of files and the size and ask whether to go on")
+var flagYes = flag.Bool("y", false, "answer yes to -confirm, it doesn't ask either when stdin is not a terminal")
+var flagCheckSpace = flag.Bool("check-space", true, "before downloading, abort if the disk has less free space than the content needs")
+var flagAddExt = flag.Bool("add-ext", false, "when downloading, give files without an extension one that matches their content (e.g. .png)")
+var flagMaxDepth = flag.Int("max-depth", 0, "limit how many directory levels are listed and downloaded (1 = immediate children only, 0 = no limit)")
+var flagRename = StringListFlag("rename", "when downloading, write the entry at this path below the CID under another name, as old=new (repeatable)")
+
+// Formats a size for output, humanized like 4.2 MB unless -raw-size asks for the exact byte count.
+func FormatSize(size uint64) string {
+	if *flagRawSize {
+		return fmt.Sprintf("%d B", size)
+	}
+	return humanize.Bytes(size)
+}
+
+// A flag that can be given several times, every value is kept.
+type StringList []string
+
+func (l *StringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func StringListFlag(name string, usage string) *StringList {
+	var l StringList
+	flag.Var(&l, name, usage)
+	return &l
+}
 
 func SetupPlugins(externalPluginsPath string) error {
 	// Load any external plugins if available on externalPluginsPath
 	plugins, err := loader.NewPluginLoader(filepath.Join(externalPluginsPath, "plugins"))
 	if err != nil {
-		return fmt.Errorf("error loading plugins: %s", err)
+		return fmt.Errorf("error loading plugins: %w", err)
 	}
 
 	// Load preloaded and external plugins
 	if err := plugins.Initialize(); err != nil {
-		return fmt.Errorf("error initializing plugins: %s", err)
+		return fmt.Errorf("error initializing plugins: %w", err)
 	}
 
 	if err := plugins.Inject(); err != nil {
-		return fmt.Errorf("error initializing plugins: %s", err)
+		return fmt.Errorf("error initializing plugins: %w", err)
 	}
 
 	return nil
@@ -51,13 +158,67 @@ func SetupPlugins(externalPluginsPath string) error {
 func CreateTempRepo() (string, error) {
 	repoPath, err := os.MkdirTemp("", "ipfs-shell")
 	if err != nil {
-		return "", fmt.Errorf("failed to get temp dir: %s", err)
+		return "", fmt.Errorf("failed to get temp dir: %w", err)
 	}
 
-	// Create a config with default options and a 2048 bit key
-	cfg, err := config.Init(io.Discard, 2048)
+	err = InitRepo(repoPath)
 	if err != nil {
-		return "", err
+		// the half-initialized repo is of no use to anyone, every run gets a new one
+		os.RemoveAll(repoPath)
+		return "", fmt.Errorf("failed to init ephemeral node: %w", err)
+	}
+
+	return repoPath, nil
+}
+
+// Returns a cancel func that also closes the node and removes the temporary repo at repoPath once cancel ran, or
+// with -keep-temp prints where the repo was kept. node is read when the returned func runs, it may not exist yet.
+func TempRepoCleanup(cancel context.CancelFunc, repoPath string, node **core.IpfsNode) context.CancelFunc {
+	return func() {
+		cancel()
+		// the repo has to be closed before its files go, closing waits for the node to stop
+		if *node != nil {
+			(*node).Close()
+		}
+		if *flagKeepTemp {
+			fmt.Fprintf(output.Status, "Kept the temporary repo at %s\n", repoPath)
+			return
+		}
+		os.RemoveAll(repoPath)
+	}
+}
+
+// Initializes a new repo with our config at repoPath. Flags changing the config only take effect here, so an already
+// initialized persistent repo keeps the config it was created with.
+func InitRepo(repoPath string) error {
+	cfg, err := NewConfig()
+	if err != nil {
+		return err
+	}
+
+	// Create the repo with the config
+	return fsrepo.Init(repoPath, cfg)
+}
+
+// Returns a new node config with a fresh identity (or the one from -identity-seed) and the config flags applied.
+func NewConfig() (*config.Config, error) {
+	var cfg *config.Config
+	var err error
+	if *flagIdentitySeed != "" {
+		identity, err := IdentityFromSeed(*flagIdentitySeed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive identity from seed: %w", err)
+		}
+		cfg, err = config.InitWithIdentity(identity)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Create a config with default options and a 2048 bit key
+		cfg, err = config.Init(io.Discard, 2048)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// When creating the repository, you can define custom settings on the repository, such as enabling experimental
@@ -76,42 +237,198 @@ func CreateTempRepo() (string, error) {
 		// And: https://github.com/ipfs/kubo/blob/master/docs/experimental-features.md
 	}
 
-	// Create the repo with the config
-	err = fsrepo.Init(repoPath, cfg)
+	if len(*flagSwarmFilters) > 0 {
+		addrFilters, err := SwarmAddrFilters(*flagSwarmFilters)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Swarm.AddrFilters = append(cfg.Swarm.AddrFilters, addrFilters...)
+	}
+
+	// peers only dial what we advertise, internal addresses behind a NAT just make them time out
+	if len(*flagAnnounce) > 0 {
+		if err := ValidateMultiaddrs("announce", *flagAnnounce); err != nil {
+			return nil, err
+		}
+		cfg.Addresses.Announce = *flagAnnounce
+	}
+	if len(*flagNoAnnounce) > 0 {
+		if err := ValidateMultiaddrs("no-announce", *flagNoAnnounce); err != nil {
+			return nil, err
+		}
+		cfg.Addresses.NoAnnounce = append(cfg.Addresses.NoAnnounce, *flagNoAnnounce...)
+	}
+
+	if *flagFastDht {
+		if !*flagExp {
+			return nil, UsageError{errors.New("-fast-dht is experimental, enable it together with -experimental")}
+		}
+		// https://github.com/ipfs/kubo/blob/master/docs/config.md#routingaccelerateddhtclient
+		// crawls the whole DHT on startup (takes minutes and lots of connections), after that lookups skip the slow hops
+		cfg.Routing.AcceleratedDHTClient = true
+	}
+
+	// kubo has it on by default, two nodes on one LAN then find each other without the DHT
+	cfg.Discovery.MDNS.Enabled = *flagMdns
+
+	if *flagNoBootstrap {
+		// with no bootstrap peers the node only knows the -peers-file peers and whoever dials it
+		cfg.Bootstrap = []string{}
+	}
+
+	routingOff, err := ContentRoutingOff()
 	if err != nil {
-		return "", fmt.Errorf("failed to init ephemeral node: %s", err)
+		return nil, err
+	}
+	if routingOff {
+		if *flagFastDht {
+			return nil, UsageError{errors.New("-fast-dht can't be combined with -content-routing none")}
+		}
+		// mDNS (on unless -mdns=false) and -peers-file are the only ways left to find peers, the bootstrap nodes would
+		// only cause WAN traffic
+		cfg.Bootstrap = []string{}
 	}
 
-	return repoPath, nil
+	if !*flagListen {
+		// without listeners there is nothing to advertise, other peers are only reached through our own dials
+		cfg.Addresses.Swarm = []string{}
+		cfg.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+		cfg.Swarm.RelayService.Enabled = config.False
+	}
+
+	if *flagLowPower {
+		if *flagFastDht {
+			return nil, UsageError{errors.New("-fast-dht crawls the whole DHT, it can't be combined with -low-power")}
+		}
+		// DHT client mode is picked in CreateNode, these only keep the node from doing work for others in the background
+		cfg.Swarm.ConnMgr.LowWater = config.NewOptionalInteger(20)
+		cfg.Swarm.ConnMgr.HighWater = config.NewOptionalInteger(40)
+		cfg.Swarm.ConnMgr.GracePeriod = config.NewOptionalDuration(20 * time.Second)
+		// uploads are still announced once by ProvideDag, just not again every 22h
+		cfg.Reprovider.Interval = config.NewOptionalDuration(0)
+		cfg.AutoNAT.ServiceMode = config.AutoNATServiceDisabled
+	}
+
+	memLimit, err := MemLimit()
+	if err != nil {
+		return nil, err
+	}
+	if memLimit > 0 {
+		ApplyMemLimit(cfg, memLimit)
+	}
+
+	return cfg, nil
+}
+
+// Makes sure a persistent repo exists at repoPath, initializing it on first use. A repo left partially initialized by
+// an interrupted init is refused, -repo-repair completes it.
+func OpenOrInitRepo(repoPath string) error {
+	if *flagRepoRepair {
+		if err := RepairRepo(repoPath); err != nil {
+			return fmt.Errorf("repo repair failed: %w", err)
+		}
+	} else if missing, partial := MissingRepoFiles(repoPath); partial {
+		return fmt.Errorf("the repo at %s appears partially initialized (missing %s), run again with -repo-repair", repoPath, strings.Join(missing, ", "))
+	}
+
+	if fsrepo.IsInitialized(repoPath) {
+		return CheckRepoVersion(repoPath)
+	}
+
+	fmt.Fprintf(output.Status, "Initializing a new repo at %s\n", repoPath)
+	err := InitRepoAtomic(repoPath)
+	if err != nil {
+		return fmt.Errorf("failed to init repo: %w", err)
+	}
+	return nil
+}
+
+// Compares the version of the repo at repoPath with the one the embedded kubo expects. An older repo is migrated with
+// -repo-migrate, which downloads the migration tools from dist.ipfs.tech like `ipfs daemon --migrate` does. Otherwise
+// the returned error says which versions are involved and how to migrate.
+func CheckRepoVersion(repoPath string) error {
+	version, err := migrations.RepoVersion(repoPath)
+	if err != nil {
+		return fmt.Errorf("could not read the repo version: %w", err)
+	}
+	switch {
+	case version == fsrepo.RepoVersion:
+		return nil
+	case version > fsrepo.RepoVersion:
+		return fmt.Errorf("the repo at %s has version %d, this fsg only supports up to version %d, use a newer fsg", repoPath, version, fsrepo.RepoVersion)
+	case !*flagRepoMigrate:
+		return fmt.Errorf("the repo at %s needs migration from v%d to v%d, run again with -repo-migrate or use fs-repo-migrations", repoPath, version, fsrepo.RepoVersion)
+	}
+
+	fmt.Fprintf(output.Status, "Migrating the repo at %s from v%d to v%d\n", repoPath, version, fsrepo.RepoVersion)
+	fetcher := migrations.NewHttpFetcher(migrations.GetDistPathEnv(migrations.CurrentIpfsDist), "", "fsg", 0)
+	defer fetcher.Close()
+	err = migrations.RunMigration(context.Background(), fetcher, fsrepo.RepoVersion, repoPath, false)
+	if err != nil {
+		return fmt.Errorf("repo migration failed: %w", err)
+	}
+	return nil
 }
 
-// Creates an IPFS node and returns its coreAPI.
-func CreateNode(ctx context.Context, repoPath string) (*core.IpfsNode, error) {
+// Creates an IPFS node and returns its coreAPI. An offline node never connects to the network.
+func CreateNode(ctx context.Context, repoPath string, online bool) (*core.IpfsNode, error) {
 	// Open the repo
 	repo, err := fsrepo.Open(repoPath)
 	if err != nil {
 		return nil, err
 	}
+	if *flagConfigDump {
+		if err := DumpConfig(repo, repoPath); err != nil {
+			repo.Close()
+			return nil, err
+		}
+	}
+	if *flagDryRun {
+		repo.Close()
+		return nil, errDryRun
+	}
 
 	// Construct the node
 
 	nodeOptions := &core.BuildCfg{
-		Online:  true,
-		Routing: libp2p.DHTOption, // This option sets the node to be a full DHT node (both fetching and storing DHT Records)
-		// Routing: libp2p.DHTClientOption, // This option sets the node to be a client DHT node (only fetching records)
-		Repo: repo,
+		Online:  online,
+		Routing: NodeRouting(),
+		Repo:    repo,
 	}
 
 	return core.NewNode(ctx, nodeOptions)
 }
 
+// Returns how the node takes part in the DHT.
+func NodeRouting() libp2p.RoutingOption {
+	if off, _ := ContentRoutingOff(); off {
+		return libp2p.NilRouterOption // no DHT at all, peers are only found through mDNS and -peers-file
+	}
+	if *flagLowPower || !*flagListen {
+		return libp2p.DHTClientOption // only fetch DHT records, don't store and serve them for others
+	}
+	return libp2p.DHTOption // This option sets the node to be a full DHT node (both fetching and storing DHT Records)
+}
+
+// Whether content routing is turned off with -content-routing none.
+func ContentRoutingOff() (bool, error) {
+	switch *flagContentRouting {
+	case "dht":
+		return false, nil
+	case "none":
+		return true, nil
+	}
+	return false, UsageError{fmt.Errorf("unknown -content-routing %q, use dht or none", *flagContentRouting)}
+}
+
 func GetUnixfsNode(path string) (files.Node, error) {
 	st, err := os.Stat(path)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := files.NewSerialFile(path, false, st)
+	// only entries below path are filtered, a hidden path itself is still added
+	f, err := files.NewSerialFile(path, *flagIncludeHidden, st)
 	if err != nil {
 		return nil, err
 	}
@@ -119,50 +436,318 @@ func GetUnixfsNode(path string) (files.Node, error) {
 	return f, nil
 }
 
-func ForeverSpin() {
-	bar := progressbar.Default(-1)
+// Returns the node to add for filePath, single files come wrapped into a directory.
+func GetUploadNode(filePath string) (files.Node, error) {
+	someFile, err := GetUploadEntry(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	//for the future simplicity to download single files in the same directory. Opened ticked on ipfs here: https://github.com/ipfs/boxo/issues/520
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	// wrap file into directory with filename so ipfs shows file name later as a workaround which doesn't allow to download into same directory
+	if !fileInfo.IsDir() {
+		someFile = files.NewSliceDirectory([]files.DirEntry{
+			files.FileEntry(filepath.Base(filePath), someFile),
+		})
+	}
+
+	return someFile, nil
+}
+
+// Returns the file or directory at filePath as it is added, with -max-file-size and -modified-since applied.
+func GetUploadEntry(filePath string) (files.Node, error) {
+	if *flagMaxFileSize != "" {
+		limit, err := humanize.ParseBytes(*flagMaxFileSize)
+		if err != nil {
+			return nil, UsageError{fmt.Errorf("invalid -max-file-size %q: %w", *flagMaxFileSize, err)}
+		}
+		err = CheckUploadSize(filePath, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	someFile, err := GetUnixfsNode(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfo, err := os.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if *flagModifiedSince != "" {
+		since, err := ParseModifiedSince(*flagModifiedSince, time.Now())
+		if err != nil {
+			return nil, UsageError{fmt.Errorf("invalid -modified-since: %w", err)}
+		}
+		if !fileInfo.IsDir() {
+			if !fileInfo.ModTime().After(since) {
+				return nil, fmt.Errorf("%s was not modified since %s", filePath, since.Format(time.DateTime))
+			}
+		} else {
+			keep, err := ModifiedPaths(filePath, since)
+			if err != nil {
+				return nil, err
+			}
+			if len(keep) == 0 {
+				return nil, fmt.Errorf("nothing in %s was modified since %s", filePath, since.Format(time.DateTime))
+			}
+			someFile = &modifiedDirectory{Directory: someFile.(files.Directory), keep: keep}
+		}
+	}
+
+	return someFile, nil
+}
+
+// Returns an error naming the first file under filePath bigger than limit, or filePath itself when all of its files
+// together are. Like the add it skips hidden files unless -include-hidden is set and doesn't follow symlinks.
+func CheckUploadSize(filePath string, limit uint64) error {
+	var total uint64
+	err := filepath.WalkDir(filePath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !*flagIncludeHidden && p != filePath && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size := uint64(info.Size())
+		if size > limit {
+			return fmt.Errorf("%s is %s, more than the -max-file-size of %s", p, FormatSize(size), FormatSize(limit))
+		}
+		total += size
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if total > limit {
+		return fmt.Errorf("%s holds %s in total, more than the -max-file-size of %s", filePath, FormatSize(total), FormatSize(limit))
+	}
+	return nil
+}
+
+// Spins until the process exits. When status is not nil its current value is shown next to the spinner.
+func ForeverSpin(status fmt.Stringer) {
+	if *flagJsonProgress {
+		lastStatus := ""
+		for {
+			if status != nil && status.String() != lastStatus {
+				lastStatus = status.String()
+				EmitEvent("status", map[string]any{"status": lastStatus})
+			}
+			time.Sleep(time.Second)
+		}
+	}
+
+	if !ProgressEnabled() {
+		// no spinner to keep alive, a line now and then still shows the node is running
+		for {
+			time.Sleep(progressLineInterval)
+			if status != nil {
+				fmt.Fprintf(output.Status, "Seeding: %s\n", status)
+			}
+		}
+	}
+
+	bar := output.NewProgressBar(-1, "", true)
 	for {
+		if status != nil {
+			bar.Describe(status.String())
+		}
 		bar.Add(1)
 		time.Sleep(100 * time.Millisecond)
 	}
 }
 
-func StartIpfsNode() (context.Context, icore.CoreAPI, context.CancelFunc, error) {
-	fmt.Println("-- Getting an IPFS node running -- ")
+func StartIpfsNode() (context.Context, icore.CoreAPI, *core.IpfsNode, context.CancelFunc, error) {
+	fmt.Fprintln(output.Status, "-- Getting an IPFS node running -- ")
+	started := time.Now()
 
 	ctx, cancel := context.WithCancel(context.Background())
+	fail := func(err error) (context.Context, icore.CoreAPI, *core.IpfsNode, context.CancelFunc, error) {
+		cancel()
+		return nil, nil, nil, nil, fmt.Errorf("failed to spawn node: %w", err)
+	}
 
-	// Spawn a node using a temporary path, creating a temporary repo for the run
-	fmt.Println("Spawning Kubo node on a temporary repo")
-	ipfsB, _, err := SpawnEphemeral(ctx)
+	if err := SetupPluginsOnce(); err != nil {
+		return fail(err)
+	}
+	if _, err := ContentRoutingOff(); err != nil {
+		return fail(err)
+	}
+	if _, err := MemLimit(); err != nil {
+		return fail(err)
+	}
+	if *flagVerifyInterval > 0 && *flagRepo == "" {
+		return fail(UsageError{errors.New("-verify-interval needs a -repo, a temporary repo holds no pins to check")})
+	}
+	if *flagMinimalBlockstore && *flagRepo != "" {
+		return fail(UsageError{errors.New("-minimal-blockstore keeps the blocks in memory, it can't be combined with -repo")})
+	}
+
+	if *flagAgent != "" {
+		// the embedded node builds its libp2p host with kubo's agent, only a suffix can be added to it
+		ipfs.SetUserAgentSuffix(*flagAgent)
+	}
+	// like GOMEMLIMIT it counts for the whole process, not just the node
+	memLimit, _ := MemLimit()
+	SetMemLimit(memLimit)
+
+	var node *core.IpfsNode
+	var err error
+	if *flagSeedCar != "" {
+		StartupStage(1, fmt.Sprintf("Opening %s", *flagSeedCar))
+		StartupStage(2, fmt.Sprintf("Spawning Kubo node serving the blocks of %s", *flagSeedCar))
+		_, node, err = SpawnFromCar(ctx, *flagSeedCar)
+		if err != nil {
+			return fail(err)
+		}
+	} else if *flagMinimalBlockstore {
+		StartupStage(1, "Keeping the blocks in memory, no repo on disk")
+		StartupStage(2, "Spawning Kubo node")
+		_, node, err = SpawnInMemory(ctx)
+		if err != nil {
+			return fail(err)
+		}
+	} else {
+		repoPath := *flagRepo
+		if repoPath != "" {
+			StartupStage(1, fmt.Sprintf("Opening the repo at %s", repoPath))
+			err = OpenOrInitRepo(repoPath)
+		} else {
+			// Spawn a node using a temporary path, creating a temporary repo for the run
+			StartupStage(1, "Creating a temporary repo")
+			repoPath, err = CreateTempRepo()
+			if err == nil {
+				cancel = TempRepoCleanup(cancel, repoPath, &node)
+			}
+		}
+		if err != nil {
+			return fail(err)
+		}
+
+		StartupStage(2, "Spawning Kubo node")
+		node, err = CreateNode(ctx, repoPath, true)
+		if err != nil {
+			return fail(err)
+		}
+	}
+	ipfsB, err := coreapi.NewCoreAPI(node)
 	if err != nil {
-		panic(fmt.Errorf("failed to spawn ephemeral node: %s", err))
+		return fail(err)
+	}
+	if *flagConnectTimeout > 0 {
+		// the node started bootstrapping with the default 10s per dial already, restarting it applies the timeout
+		if err := node.Bootstrap(BootstrapConfig()); err != nil {
+			return fail(err)
+		}
+	}
+
+	// a persistent repo keeps the mDNS setting it was created with, so ask the config instead of -mdns
+	if cfg, err := node.Repo.Config(); err == nil && cfg.Discovery.MDNS.Enabled {
+		ReportLocalPeers(ctx, node)
+	}
+
+	listenAddrs, err := ipfsB.Swarm().ListenAddrs(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	StartupStage(3, fmt.Sprintf("Listening on %d addresses", len(listenAddrs)))
+
+	// the node dials the bootstrap peers on its own as soon as it is constructed
+	bootstrapCount := 0
+	if cfg, err := node.Repo.Config(); err == nil {
+		bootstrapCount = len(cfg.Bootstrap)
+	}
+	StartupStage(4, fmt.Sprintf("Connecting to %d bootstrap peers", bootstrapCount))
+	var peers []peer.AddrInfo
+	if *flagPeersFile != "" {
+		peers, err = LoadPeersFile(*flagPeersFile)
+		if err != nil {
+			cancel()
+			return nil, nil, nil, nil, fmt.Errorf("failed to read peers file: %w", err)
+		}
+		ConnectPeers(ctx, ipfsB, peers)
+	}
+	if *flagBootstrapInterval > 0 {
+		// downloads need peers as much as seeding does, so the checks start with the node
+		go KeepConnected(ctx, node)
+	}
+
+	if *flagApi != "" {
+		stopApi, err := ServeApi(ctx, node, *flagApi)
+		if err != nil {
+			cancel()
+			return nil, nil, nil, nil, err
+		}
+		// callers cancel on their way out, the socket file has to be gone by then
+		cancelNode := cancel
+		cancel = func() {
+			stopApi()
+			cancelNode()
+		}
+	}
+	if *flagBugReport != "" {
+		// the peers are gone once the node stops, so they are taken on the way out
+		cancelNode := cancel
+		cancel = func() {
+			bugReport.Snapshot(node)
+			cancelNode()
+		}
 	}
 
-	fmt.Println("IPFS node is running")
+	StartupStage(5, "Waiting for the first peer")
+	go ReportFirstPeer(ctx, ipfsB, started)
+
+	fmt.Fprintln(output.Status, "IPFS node is running")
+	timings.Since("node startup", started)
+
+	if *flagJsonProgress {
+		go EmitPeerEvents(ctx, ipfsB)
+	}
 
-	return ctx, ipfsB, cancel, err
+	return ctx, ipfsB, node, cancel, err
 }
 
 var loadPluginsOnce sync.Once
+var loadPluginsErr error
 
-// Spawns a node to be used just for this run (i.e. creates a tmp repo).
-func SpawnEphemeral(ctx context.Context) (icore.CoreAPI, *core.IpfsNode, error) {
-	var onceErr error
+// Loads the plugins the first time a node is spawned, they can't be injected twice.
+func SetupPluginsOnce() error {
 	loadPluginsOnce.Do(func() {
-		onceErr = SetupPlugins("")
+		loadPluginsErr = SetupPlugins("")
 	})
-	if onceErr != nil {
-		return nil, nil, onceErr
+	return loadPluginsErr
+}
+
+// Spawns a node on the persistent repo at repoPath, so keys, pins and blocks are kept between runs.
+func SpawnPersistent(ctx context.Context, repoPath string, online bool) (icore.CoreAPI, *core.IpfsNode, error) {
+	if err := SetupPluginsOnce(); err != nil {
+		return nil, nil, err
 	}
 
-	// Create a Temporary Repo
-	repoPath, err := CreateTempRepo()
+	err := OpenOrInitRepo(repoPath)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create temp repo: %s", err)
+		return nil, nil, err
 	}
 
-	node, err := CreateNode(ctx, repoPath)
+	node, err := CreateNode(ctx, repoPath, online)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -173,147 +758,1169 @@ func SpawnEphemeral(ctx context.Context) (icore.CoreAPI, *core.IpfsNode, error)
 }
 
 func UploadFiles(flagFilePath string) (cidStr string, err error) {
-	ctx, ipfsA, cancel, err := StartIpfsNode()
+	if *flagSeedFile != "" && *flagRepo == "" {
+		return "", errSeedFileNeedsRepo
+	}
+	if *flagMinimalBlockstore {
+		return "", UsageError{errors.New("-minimal-blockstore is for downloads, an upload would keep all of its blocks in memory while it is seeded")}
+	}
+	if *flagShareExpiry < 0 {
+		return "", UsageError{fmt.Errorf("-share-expiry can't be negative, not %s", *flagShareExpiry)}
+	}
+	if *flagShareExpiry > 0 && *flagSeedDuration > 0 && *flagSeedDuration < *flagShareExpiry {
+		return "", UsageError{fmt.Errorf("-seed-duration %s stops seeding before the -share-expiry %s is over", *flagSeedDuration, *flagShareExpiry)}
+	}
+	if *flagPinName != "" {
+		if *flagRepo == "" {
+			return "", errPinNameNeedsRepo
+		}
+		if err := ValidatePinName(*flagPinName); err != nil {
+			return "", err
+		}
+	}
+	if api, ok, err := RunningNodeApi(*flagRepo); err != nil {
+		return "", err
+	} else if ok {
+		if *flagWatch || *flagPublish {
+			return "", UsageError{errors.New("-watch and -publish need a node of their own, stop the node running on the -repo first")}
+		}
+		// both wait while this run seeds, through the API the running node seeds and this run exits right away
+		if *flagPinRemote != "" || *flagShareExpiry > 0 {
+			return "", UsageError{errors.New("-pin-remote and -share-expiry need a node of their own, stop the node running on the -repo first")}
+		}
+		return UploadThroughApi(api, flagFilePath)
+	}
+
+	prefetched, err := PrefetchUploadStats(flagFilePath)
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", err
 	}
 
-	someFile, err := GetUnixfsNode(flagFilePath)
+	// -max-file-size and -modified-since can refuse the upload, that is known before a node is started
+	someFile, err := GetUploadNode(flagFilePath)
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", err
+	}
+	var digests *Sha256Digests
+	if *flagSha256 {
+		digests = NewSha256Digests()
+		someFile = digests.Wrap(someFile, "")
 	}
 
-	//for the future simplicity to download single files in the same directory. Opened ticked on ipfs here: https://github.com/ipfs/boxo/issues/520
+	ctx, ipfsA, node, cancel, err := StartIpfsNode()
+	if err != nil {
+		return "", err
+	}
+	defer cancel()
+
 	fileInfo, err := os.Stat(flagFilePath)
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", err
 	}
 
-	// wrap file into directory with filename so ipfs shows file name later as a workaround which doesn't allow to download into same directory
-	if !fileInfo.IsDir() {
-		someFile = files.NewSliceDirectory([]files.DirEntry{
-			files.FileEntry(filepath.Base(flagFilePath), someFile),
-		})
+	addOptions, err := UnixfsAddOptions()
+	if err != nil {
+		return "", err
 	}
 
-	cidFile, err := ipfsA.Unixfs().Add(ctx, someFile)
+	inBlocks, err := ProgressInBlocks()
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", err
+	}
+	added := NewAddProgress()
+	if inBlocks && !added.CountsBlocks() {
+		return "", UsageError{errors.New("-progress-unit blocks needs a size-<bytes> -chunker, the other chunkers cut blocks by content")}
+	}
+	events := make(chan interface{}, 16)
+	addOptions = append(addOptions, options.Unixfs.Progress(true), options.Unixfs.Events(events))
+	trackDone := make(chan struct{})
+	go func() {
+		added.Track(events)
+		close(trackDone)
+	}()
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+
+	// a persistent repo can still hold the blocks of an earlier, interrupted add of the same files
+	var resume *ResumeBlockstore
+	addApi := ipfsA
+	if *flagRepo != "" {
+		resume = &ResumeBlockstore{Blockstore: node.BaseBlocks}
+		node.BaseBlocks = resume
+		addApi, err = coreapi.NewCoreAPI(node)
+		if err != nil {
+			cancelProgress()
+			return "", err
+		}
+		go ReportResume(progressCtx, resume)
+	}
+
+	current, total := added.Hashed, int64(-1)
+	if inBlocks {
+		current = added.Blocks
+	} else if prefetched >= 0 && *flagModifiedSince == "" {
+		// -modified-since leaves files out, only the filtered directory knows its size
+		total = prefetched
+	} else if size, err := someFile.Size(); err == nil {
+		total = size
+	}
+	progressDone := make(chan struct{})
+	go func() {
+		ShowProgress(progressCtx, "adding", "Added", current, total, inBlocks)
+		close(progressDone)
+	}()
+	// the add sends its events synchronously, once it returned all of them are in the channel. The bar has to be gone
+	// before anything else is printed, so stopping waits for it
+	stopProgress := func() {
+		close(events)
+		<-trackDone
+		cancelProgress()
+		<-progressDone
+	}
+
+	addStarted := time.Now()
+	cidFile, err := addApi.Unixfs().Add(ctx, someFile, addOptions...)
+	stopProgress()
+	timings.Since("add", addStarted)
+	if err != nil {
+		return "", err
+	}
+	added.NoteMissingEvents()
+	if resume != nil {
+		if percent := resume.AlreadyPercent(); percent > 0 {
+			fmt.Fprintf(output.Status, "Resumed an earlier add, %d%% was already in repo\n", percent)
+		}
+	}
+
+	// uploads are pinned on a persistent repo, a pin that is already there means the same content was shared before
+	alreadyShared := false
+	if *flagRepo != "" {
+		_, alreadyShared, err = ipfsA.Pin().IsPinned(ctx, cidFile, options.Pin.IsPinned.Recursive())
+		if err != nil {
+			return "", err
+		}
+		if !alreadyShared {
+			err = ipfsA.Pin().Add(ctx, cidFile, options.Pin.Recursive(true))
+			if err != nil {
+				return "", err
+			}
+		}
+		if *flagPinName != "" {
+			if err := NamePin(*flagRepo, *flagPinName, cidFile.RootCid()); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	shareLink := cidFile.String()
+	if *flagShareExpiry > 0 {
+		shareUntil = time.Now().Add(*flagShareExpiry)
+		shareLink = ShareLink(cidFile, shareUntil)
+	}
+	if alreadyShared {
+		fmt.Fprintf(output.Status, "Already shared (CID unchanged), share this CID with your friend:\n%s\n", shareLink)
+	} else {
+		fmt.Fprintf(output.Status, "Added file to IPFS. Now share this CID with your friend:\n%s\n", shareLink)
+	}
+	if !shareUntil.IsZero() {
+		fmt.Fprintf(output.Status, "Available until %s\n", shareUntil.Format(time.DateTime+" MST"))
+	}
+	if *flagStdoutCid {
+		output.WriteResult([]byte(cidFile.RootCid().String() + "\n"))
+	}
+	if digests != nil {
+		digests.Print()
+	}
+	if *flagJsonProgress {
+		EmitEvent("done", map[string]any{"cid": cidFile.RootCid().String()})
 	}
 
-	fmt.Printf("Added file to IPFS. Now share this CID with your friend:\n%s\n", cidFile.String())
+	if *flagPinRemote != "" {
+		endpoint, key, err := RemotePinService(*flagPinRemote, *flagRepo)
+		if err != nil {
+			return "", err
+		}
+		// the pinning service fetches the blocks from us, so keep seeding until it reports the pin is done
+		go func() {
+			err := PinRemote(ctx, ipfsA, endpoint, key, cidFile.RootCid(), filepath.Base(flagFilePath))
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nerror pinning remotely: %s\n", err)
+			} else if err == nil {
+				fmt.Fprintln(output.Status, "\nRemote pin done, it is safe to stop seeding now")
+			}
+		}()
+	}
+
+	// what was seeded before is announced again too, a restarted seeder serves the same set
+	if *flagSeedFile != "" {
+		added, err := AddToSeedFile(*flagSeedFile, cidFile.RootCid())
+		if err != nil {
+			return "", fmt.Errorf("could not update the -seed-file: %w", err)
+		}
+		if added {
+			fmt.Fprintf(output.Status, "Added to %s\n", *flagSeedFile)
+		}
+		seedList, err := LoadSeedFile(*flagSeedFile)
+		if err != nil {
+			return "", err
+		}
+		ProvideSeedList(ctx, ipfsA, seedList, cidFile.RootCid())
+	}
+
+	// the CID can be shared right away, announcing all blocks to the DHT keeps going in the background while seeding
+	// without a DHT there is nowhere to announce to, peers on the LAN ask us directly over bitswap
+	var seedStatus fmt.Stringer
+	if routingOff, _ := ContentRoutingOff(); !routingOff {
+		provideProgress := &ProvideProgress{}
+		seedStatus = provideProgress
+		go func() {
+			provideStarted := time.Now()
+			err := ProvideDag(ctx, ipfsA, cidFile.RootCid(), provideProgress)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nerror providing blocks: %s\n", err)
+			} else if err == nil {
+				timings.Since("provide", provideStarted)
+			}
+		}()
+	}
+
+	if *flagWatch {
+		// publishes the first root too, one after the other keeps the IPNS record sequence in order
+		go WatchAndRepublish(ctx, ipfsA, flagFilePath, cidFile)
+	} else if *flagPublish {
+		go func() {
+			err := PublishName(ctx, ipfsA, cidFile)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\n%s\n", err)
+			}
+		}()
+	}
 
 	// you can find how many files and filenames with below counter code. Just try uploading/downloading single file from same dir and later upload directory
 	c, err := ipfsA.Unixfs().Ls(ctx, cidFile)
 	if err != nil {
-		panic(fmt.Errorf("could not find Ls from Cid: %s", err))
+		return "", fmt.Errorf("could not find Ls from Cid: %w", err)
 	}
 	fileCounter := 0
 	for de := range c {
 		fileCounter += 1
-		fmt.Printf("%d file name: %v\n", fileCounter, de.Name)
+		if de.Type == icore.TFile {
+			fmt.Fprintf(output.Status, "%d file name: %v (%s)\n", fileCounter, de.Name, FormatSize(de.Size))
+		} else {
+			fmt.Fprintf(output.Status, "%d file name: %v\n", fileCounter, de.Name)
+		}
 	}
 
 	fileSize, err := someFile.Size()
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", err
+	}
+
+	fmt.Fprintf(output.Status, "Seeding size: %s\n", FormatSize(uint64(fileSize)))
+
+	// empty content still gets a valid CID, just make sure the user knows nothing useful is being shared
+	if fileSize == 0 {
+		if fileInfo.IsDir() {
+			fmt.Fprintf(output.Status, "Note: %s is an empty directory\n", flagFilePath)
+		} else {
+			fmt.Fprintf(output.Status, "Note: %s is an empty file\n", flagFilePath)
+		}
 	}
 
-	fmt.Printf("Seeding size: %s\n", humanize.Bytes(uint64(fileSize)))
+	SeedUntilStopped(ctx, node, seedStatus)
+	timings.Print()
 
-	go ForeverSpin()
+	fmt.Fprintln(output.Status, "Adios!")
+
+	return cidFile.String(), err
+}
+
+// Keeps the node serving with a spinner (showing status if not nil) until a signal arrives, -seed-duration is over or
+// nothing was served for -idle-timeout.
+func SeedUntilStopped(ctx context.Context, node *core.IpfsNode, status fmt.Stringer) {
+	if *flagAccessLog != "" {
+		logCtx, stopLogging := context.WithCancel(ctx)
+		defer stopLogging()
+		go func() {
+			err := LogAccess(logCtx, node, *flagAccessLog)
+			if err != nil && logCtx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nerror writing access log: %s\n", err)
+			}
+		}()
+	}
+
+	// with -bootstrap-interval the node watches its peers since it started
+	if *flagBootstrapInterval == 0 {
+		keepaliveCtx, stopKeepalive := context.WithCancel(ctx)
+		defer stopKeepalive()
+		go KeepConnected(keepaliveCtx, node)
+	}
+
+	if *flagVerifyInterval > 0 {
+		verifyCtx, stopVerifying := context.WithCancel(ctx)
+		defer stopVerifying()
+		go VerifyPeriodically(verifyCtx, node, *flagVerifyInterval)
+	}
+
+	go ForeverSpin(status)
 
 	quitChannel := make(chan os.Signal, 1)
 	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
-	<-quitChannel
 
-	fmt.Println("\nAdios!")
-	ctx.Done()
-	defer cancel()
+	// a nil channel never fires, so without -seed-duration only a signal stops seeding
+	var seedTimeout <-chan time.Time
+	if *flagSeedDuration > 0 {
+		seedTimeout = time.After(*flagSeedDuration)
+	}
+	var shareExpired <-chan time.Time
+	if !shareUntil.IsZero() {
+		shareExpired = time.After(time.Until(shareUntil))
+	}
+	var idle <-chan struct{}
+	if *flagIdleTimeout > 0 {
+		idleCtx, stopWatching := context.WithCancel(ctx)
+		defer stopWatching()
+		idle = IdleTimeout(idleCtx, node, *flagIdleTimeout)
+	}
+	select {
+	case sig := <-quitChannel:
+		fmt.Fprintf(output.Status, "\nStopped seeding: received %s\n", sig)
+	case <-seedTimeout:
+		fmt.Fprintf(output.Status, "\nStopped seeding: -seed-duration of %s is over\n", *flagSeedDuration)
+	case <-shareExpired:
+		fmt.Fprintf(output.Status, "\nStopped seeding: the share expired at %s\n", shareUntil.Format(time.DateTime))
+	case <-idle:
+		fmt.Fprintf(output.Status, "\nStopped seeding: no block was served for the -idle-timeout of %s\n", *flagIdleTimeout)
+	}
+}
 
-	return cidFile.String(), err
+// Translates upload flags into options for Unixfs().Add. Any option here can change the resulting CID.
+func UnixfsAddOptions() ([]options.UnixfsAddOption, error) {
+	var addOptions []options.UnixfsAddOption
+
+	switch *flagLayout {
+	case "balanced":
+		addOptions = append(addOptions, options.Unixfs.Layout(options.BalancedLayout))
+	case "trickle":
+		addOptions = append(addOptions, options.Unixfs.Layout(options.TrickleLayout))
+	default:
+		return nil, UsageError{fmt.Errorf("unknown layout %q, use balanced or trickle", *flagLayout)}
+	}
+	if *flagChunker != "" {
+		addOptions = append(addOptions, options.Unixfs.Chunker(*flagChunker))
+	}
+
+	return addOptions, nil
 }
 
 func GetCidStrFromString(str string) (cidStr string) {
+	// share links can carry hints like ?expires=... or ?peer=/ip4/... after the CID, the latter with slashes of its own
+	str, _, _ = strings.Cut(str, "?")
 	// in case of /ipfs/exampleCid we strip string and work only on exampleCid, in the future need to check if this is CID string
 	cidStr = str[strings.LastIndex(str, "/")+1:]
 	cidStr = strings.Trim(cidStr, " \r\n")
 	return cidStr
 }
 
+// Searches the DHT for peers providing p and returns how many were found before the timeout ran out.
+func CountProviders(ctx context.Context, ipfsA icore.CoreAPI, p path.Path, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	providers, err := ipfsA.Dht().FindProviders(ctx, p, options.Dht.NumProviders(ProvidersLimit()))
+	if err != nil {
+		return 0, err
+	}
+
+	providerCount := 0
+	for range providers {
+		providerCount += 1
+	}
+	return providerCount, nil
+}
+
+// Returns how many providers a lookup searches for, -providers or 20 when it isn't set.
+func ProvidersLimit() int {
+	if *flagProviders > 0 {
+		return *flagProviders
+	}
+	return 20
+}
+
+// Returns an offline API and true when every block under root is in the local repo already, so a download doesn't
+// need the network at all.
+func LocalDag(ctx context.Context, ipfsA icore.CoreAPI, root cid.Cid) (icore.CoreAPI, bool) {
+	offlineApi, err := ipfsA.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		return nil, false
+	}
+	_, err = CollectDagCids(ctx, offlineApi, root)
+	return offlineApi, err == nil
+}
+
+// Writes fetched UnixFS nodes to disk entry by entry like files.WriteTo, keeping count of the written bytes so the
+// download can be watched while it runs. Entries are listed while they are written, a separate Ls would resolve the
+// whole tree a second time.
+type EntryWriter struct {
+	MaxDepth  int               // directory levels below the root to write, deeper directories are created empty (0 = no limit)
+	ListDepth int               // directory levels below the root to print entries of (0 = none)
+	AddExt    bool              // append an extension sniffed from the content to files whose name has none
+	Listed    int               // entries printed so far
+	Written   atomic.Int64      // bytes written so far
+	Failed    []FailedEntry     // files inside a directory that couldn't be fetched, the other entries are still written
+	Rename    map[string]string // output names by entry path below the CID, see ParseRenames
+	Source    string            // path below the CID of the node given to WriteTo, what Rename is matched against
+	FirstByte func()            // called once when the first byte of file content is written, nil to skip
+	Manifest  *DownloadManifest // records every file written, nil to skip
+	// creates a file to write content to, fails when it exists; nil for os.OpenFile with O_EXCL
+	Create func(name string) (io.WriteCloser, error)
+
+	root          string // listed names are relative to this, the fpath of depth 0 unless set before
+	firstByteOnce sync.Once
+}
+
+// A file that couldn't be written, Path is where it would have been written to and Source its path below the CID.
+type FailedEntry struct {
+	Path   string
+	Source string
+	Err    error
+}
+
+// Writes nd to fpath, depth is how many directory levels below the download root nd is.
+func (w *EntryWriter) WriteTo(nd files.Node, fpath string, depth int) error {
+	return w.writeEntry(nd, fpath, w.Source, depth)
+}
+
+func (w *EntryWriter) writeEntry(nd files.Node, fpath string, source string, depth int) error {
+	if w.root == "" {
+		w.root = fpath
+	}
+	if depth > 0 && depth <= w.ListDepth {
+		w.Listed += 1
+		relPath, _ := filepath.Rel(w.root, fpath)
+		if f, isFile := nd.(files.File); isFile {
+			size, _ := f.Size()
+			fmt.Fprintf(output.Status, "%d file name: %v (%s)\n", w.Listed, filepath.ToSlash(relPath), FormatSize(uint64(size)))
+		} else {
+			fmt.Fprintf(output.Status, "%d file name: %v\n", w.Listed, filepath.ToSlash(relPath))
+		}
+	}
+
+	switch nd := nd.(type) {
+	case *files.Symlink:
+		return os.Symlink(nd.Target, fpath)
+	case files.File:
+		var content io.Reader = nd
+		if w.AddExt && filepath.Ext(fpath) == "" {
+			// the sniffed head has to be written too, so read it first and put it back in front of the rest
+			head := make([]byte, 3072)
+			n, err := io.ReadFull(nd, head)
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return err
+			}
+			fpath += mimetype.Detect(head[:n]).Extension()
+			content = io.MultiReader(bytes.NewReader(head[:n]), nd)
+		}
+
+		create := w.Create
+		if create == nil {
+			create = func(name string) (io.WriteCloser, error) {
+				return os.OpenFile(name, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0o666)
+			}
+		}
+		f, err := create(fpath)
+		if err != nil {
+			return err
+		}
+
+		n, err := io.Copy(&countingWriter{f, &w.Written, &w.firstByteOnce, w.FirstByte}, content)
+		// some filesystems only report a full disk when the file is closed
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// Create fails on existing files, so the file is ours and a partial one would block a retry
+			os.Remove(fpath)
+			return err
+		}
+		if w.Manifest != nil {
+			w.Manifest.Add(source, fpath, n)
+		}
+		return nil
+	case files.Directory:
+		err := os.Mkdir(fpath, 0o777)
+		if err != nil {
+			return err
+		}
+		// blocks of entries below the limit are never fetched
+		if w.MaxDepth > 0 && depth >= w.MaxDepth {
+			return nil
+		}
+
+		entries := nd.Entries()
+		for entries.Next() {
+			if !ValidEntryName(entries.Name()) {
+				return files.ErrInvalidDirectoryEntry
+			}
+			entrySource := EntrySource(source, entries.Name())
+			entryPath := filepath.Join(fpath, entries.Name())
+			if target, ok := w.Rename[entrySource]; ok {
+				entryPath = filepath.Join(fpath, filepath.FromSlash(target))
+				err = os.MkdirAll(filepath.Dir(entryPath), 0o777)
+				if err != nil {
+					return err
+				}
+			}
+			entry := entries.Node()
+			err = w.writeEntry(entry, entryPath, entrySource, depth+1)
+			if errors.Is(err, fs.ErrExist) && len(w.Rename) > 0 {
+				return fmt.Errorf("%s collides with a -rename target: %w", entryPath, err)
+			}
+			// one file that can't be fetched shouldn't cost the rest of the directory, a full disk or a cancel does
+			if _, isFile := entry.(files.File); err != nil && isFile && ExitCode(err) != ExitDisk && !errors.Is(err, context.Canceled) {
+				w.Failed = append(w.Failed, FailedEntry{entryPath, entrySource, err})
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return entries.Err()
+	default:
+		return fmt.Errorf("file type %T at %q is not supported", nd, fpath)
+	}
+}
+
+// Fetches the failed entries of a download once more, root is the downloaded CID the entry sources are below.
+// Returns the entries that failed again.
+func RetryFailedEntries(ctx context.Context, ipfsA icore.CoreAPI, root path.Path, failed []FailedEntry, manifest *DownloadManifest) []FailedEntry {
+	fmt.Fprintf(output.Status, "Retrying %d entries that could not be fetched\n", len(failed))
+	var stillFailed []FailedEntry
+	for _, entry := range failed {
+		entryPath, err := path.Join(root, strings.Split(entry.Source, "/")...)
+		if err != nil {
+			stillFailed = append(stillFailed, FailedEntry{entry.Path, entry.Source, err})
+			continue
+		}
+		nd, err := ipfsA.Unixfs().Get(ctx, entryPath)
+		if err == nil {
+			err = (&EntryWriter{AddExt: *flagAddExt, Source: entry.Source, Manifest: manifest}).WriteTo(nd, entry.Path, 0)
+		}
+		if err != nil {
+			stillFailed = append(stillFailed, FailedEntry{entry.Path, entry.Source, err})
+		}
+	}
+	return stillFailed
+}
+
+// Whether name can be used as a file name without escaping the directory it is written to.
+func ValidEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// Returns the name and node of the only entry of nd, ok is false unless nd is a directory with exactly one entry.
+// Uploads wrap single files into such a directory to keep their name.
+func SingleEntry(nd files.Node) (name string, entry files.Node, ok bool) {
+	dir, isDir := nd.(files.Directory)
+	if !isDir {
+		return "", nil, false
+	}
+	entries := dir.Entries()
+	if !entries.Next() {
+		return "", nil, false
+	}
+	name, entry = entries.Name(), entries.Node()
+	if entries.Next() || entries.Err() != nil {
+		return "", nil, false
+	}
+	return name, entry, true
+}
+
+// Returns an error when the filesystem of dir has less free space than nd takes. Platforms where free space can't be
+// looked up pass.
+func CheckFreeSpace(nd files.Node, dir string) error {
+	size, err := nd.Size()
+	if err != nil {
+		return err
+	}
+	free, err := FreeSpace(dir)
+	if err != nil {
+		return nil
+	}
+	if uint64(size) > free {
+		return fmt.Errorf("not enough disk space in %s: the download needs %s, only %s are free (%w)", dir, FormatSize(uint64(size)), FormatSize(free), syscall.ENOSPC)
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w     io.Writer
+	count *atomic.Int64
+	once  *sync.Once
+	first func() // run through once after the first bytes were written, may be nil
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.count.Add(int64(n))
+	if n > 0 && cw.first != nil {
+		cw.once.Do(cw.first)
+	}
+	return n, err
+}
+
 func DownloadFromCid(cidStr string) (outputPath string, err error, progress int64) {
+	if err := CheckStrictInputs(cidStr); err != nil {
+		return "", err, 0
+	}
+	if api, ok, err := RunningNodeApi(*flagRepo); err != nil {
+		return "", err, 0
+	} else if ok {
+		stats := StartDownloadStats(nil)
+		outputPath, written, err := FetchCid(context.Background(), api, nil, cidStr, true)
+		if err != nil {
+			return "", err, 0
+		}
+		if !*flagQuiet {
+			fmt.Fprintln(output.Status, stats.Summary(written))
+		}
+		return outputPath, nil, 100
+	}
 
-	ctx, ipfsA, cancel, err := StartIpfsNode()
-	// ctx, ipfsA, cancel, err := StartIpfsNode()
+	ctx, ipfsA, node, cancel, err := StartIpfsNode()
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", err, 0
 	}
 	defer cancel()
 
+	stats := StartDownloadStats(node)
+	outputPath, written, err := FetchCid(ctx, ipfsA, node, cidStr, true)
+	timings.Print()
+	if err != nil {
+		return "", err, 0
+	}
+	if !*flagQuiet {
+		fmt.Fprintln(output.Status, stats.Summary(written))
+	}
+
+	return outputPath, err, 100
+}
+
+// Downloads cidStr with an already running node and returns where it was written and how many bytes that took.
+// Safe to call from several goroutines sharing one node. node is nil for a client of a node running elsewhere (see
+// RunningNodeApi), that node fetches on its own and nothing below the API can be watched.
+func FetchCid(ctx context.Context, ipfsA icore.CoreAPI, node *core.IpfsNode, cidStr string, showProgress bool) (outputPath string, written int64, err error) {
+	// the hints of a share link are read before an /ipns/ name is swapped for the CID it resolves to
+	PrintShareExpiry(cidStr)
+	ConnectHintedPeers(ctx, ipfsA, cidStr)
+	if name, _, _ := strings.Cut(strings.TrimSpace(cidStr), "?"); strings.HasPrefix(name, "/ipns/") {
+		resolvedCid, err := ResolveName(ctx, ipfsA, name)
+		if err != nil {
+			return "", 0, fmt.Errorf("could not resolve %s: %w", name, err)
+		}
+		cidStr = resolvedCid.String()
+	}
 	cidStr = GetCidStrFromString(cidStr)
 	cidFromString, err := cid.Parse(cidStr)
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", 0, UsageError{err}
+	}
+	if err := CheckFileCodec(cidFromString); err != nil {
+		return "", 0, UsageError{err}
+	}
+	renames, err := ParseRenames(*flagRename)
+	if err != nil {
+		return "", 0, UsageError{err}
+	}
+	if *flagPrefetch && *flagMaxDepth > 0 {
+		return "", 0, UsageError{errors.New("-prefetch fetches the whole DAG, it can't be combined with -max-depth")}
+	}
+	if *flagDagConcurrency < 1 {
+		return "", 0, UsageError{fmt.Errorf("-dag-concurrency must be at least 1, not %d", *flagDagConcurrency)}
+	}
+	inBlocks, err := ProgressInBlocks()
+	if err != nil {
+		return "", 0, err
 	}
-	fmt.Printf("Fetching a file from the network with CID %s\n", cidStr)
 	testCID := path.FromCid(cidFromString)
 
-	rootNode, err := ipfsA.Unixfs().Get(ctx, testCID)
-	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+	// a persistent repo may hold the whole DAG from an earlier download or upload, then nothing is fetched
+	local := false
+	if *flagRepo != "" && !*flagCheckProviders {
+		if offlineApi, ok := LocalDag(ctx, ipfsA, cidFromString); ok {
+			ipfsA, local = offlineApi, true
+		}
+	}
+	if local {
+		fmt.Fprintf(output.Status, "All blocks of %s are in the local repo, served from local repo\n", cidStr)
+	} else {
+		fmt.Fprintf(output.Status, "Fetching a file from the network with CID %s\n", cidStr)
+	}
+
+	if *flagCheckProviders {
+		providerCount, err := CountProviders(ctx, ipfsA, testCID, *flagProvidersTimeout)
+		if err != nil {
+			return "", 0, fmt.Errorf("could not search for providers: %w", err)
+		}
+		fmt.Fprintf(output.Status, "Found %d provider(s) for %s\n", providerCount, cidStr)
+		if providerCount == 0 {
+			fmt.Fprintln(output.Status, "Nobody seems to be sharing this CID right now, a download would most likely hang")
+		}
+		return "", 0, nil
 	}
 
-	ctx.Done()
+	if *flagCar != "" {
+		written, err := ExportCar(ctx, ipfsA, cidFromString, *flagCar)
+		if err != nil {
+			return "", written, fmt.Errorf("could not export CAR: %w", err)
+		}
+		fmt.Fprintf(output.Status, "Exported the DAG to %s\n", *flagCar)
+		return *flagCar, written, nil
+	}
 
-	c, err := ipfsA.Unixfs().Ls(ctx, testCID)
+	// bitswap searches providers on its own, a limited lookup upfront is cheaper when one good provider is enough
+	if *flagProviders > 0 && !local {
+		lookupStarted := time.Now()
+		connected, err := ReconnectProviders(ctx, ipfsA, testCID, *flagProvidersTimeout)
+		timings.Since("provider lookup", lookupStarted)
+		if err != nil {
+			fmt.Fprintf(output.Status, "Provider search failed: %s\n", err)
+		} else {
+			fmt.Fprintf(output.Status, "Connected to %d provider(s)\n", connected)
+		}
+	}
+
+	// started before Get, which already waits for the root block
+	if *flagBlockTimeout > 0 && !local && node != nil {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		go WatchBlocks(watchCtx, ipfsA, node, *flagBlockTimeout)
+		defer stopWatching()
+	}
+
+	fetchStarted := time.Now()
+	rootNode, err := ipfsA.Unixfs().Get(ctx, testCID)
 	if err != nil {
-		panic(fmt.Errorf("could not find Ls info from Cid: %s", err))
+		return "", 0, err
 	}
-	fileCounter := 0
-	for de := range c {
-		fileCounter += 1
-		fmt.Printf("%d file name: %v\n", fileCounter, de.Name)
+	timings.Since("root block", fetchStarted)
+	if node == nil {
+		rootNode = RelistingNode(ctx, ipfsA, testCID, rootNode)
 	}
 
 	shouldWorkButNot := false // change to true and see how boxo doesn't let WriteTo same directory
 	if shouldWorkButNot {
 		outputPath = "." // save to same directory file
 	} else {
-		outputPath = "./Download/" + cidStr
+		outputPath = filepath.Join(*flagOutput, cidStr)
+	}
+
+	// a root with a single named entry is a wrapper, writing just that entry gives it a readable name
+	writeNode, writeDepth, listRoot, writeSource := rootNode, 0, outputPath, ""
+	if name, entry, ok := SingleEntry(rootNode); ok && ValidEntryName(name) {
+		_, isDir := entry.(files.Directory)
+		switch {
+		case *flagFlatten && isDir && *flagOutputNameFromCid:
+			// the directory takes the place of the wrapper, its entries are written right into the CID directory
+			writeNode, writeSource = entry, name
+		case *flagFlatten || !*flagOutputNameFromCid:
+			outputPath = filepath.Join(*flagOutput, name)
+			if target, ok := renames[name]; ok {
+				outputPath = filepath.Join(*flagOutput, filepath.FromSlash(target))
+			}
+			writeNode, writeDepth, listRoot, writeSource = entry, 1, *flagOutput, name
+		}
 	}
 
-	err = os.MkdirAll("Download", 0o777)
+	if *flagConfirm {
+		err = ConfirmDownload(writeNode)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	// only the output directory is created (and the directories a nesting -rename asks for), nothing else is written
+	// to the working directory
+	err = os.MkdirAll(filepath.Dir(outputPath), 0o777)
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
+		return "", 0, err
 	}
 
-	err = files.WriteTo(rootNode, filepath.Clean(outputPath))
+	// with -max-depth only part of the content is written, so its total size says nothing
+	if *flagCheckSpace && *flagMaxDepth == 0 {
+		err = CheckFreeSpace(rootNode, *flagOutput)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+	if *flagMinimalBlockstore && *flagMaxDepth == 0 {
+		err = CheckFreeMemory(rootNode)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	// listing used to show only the top level, keep that unless a depth was asked for
+	listDepth := *flagMaxDepth
+	if listDepth == 0 {
+		listDepth = 1
+	}
+	// with -prefetch network and disk take turns: the whole DAG is fetched into the repo first, then written from there.
+	// A client of a node running elsewhere can't, that node fetches on its own
+	prefetched := false
+	if *flagPrefetch && !local && node != nil {
+		size, err := rootNode.Size()
+		if err != nil {
+			return "", 0, err
+		}
+		stopFetchProgress := func() {}
+		if showProgress && inBlocks {
+			stopFetchProgress = StartProgress(ctx, "fetching", "Fetched", BlocksReceived(node), -1, true)
+		} else if showProgress {
+			stopFetchProgress = StartProgress(ctx, "fetching", "Fetched", BytesReceived(node), size, false)
+		}
+		prefetchStarted := time.Now()
+		err = PrefetchDag(ctx, node, cidFromString, *flagDagConcurrency)
+		stopFetchProgress()
+		if err != nil {
+			return "", 0, fmt.Errorf("could not fetch all blocks of %s: %w", cidStr, err)
+		}
+		timings.Since("prefetch", prefetchStarted)
+		fmt.Fprintln(output.Status, "All blocks are in the local repo, writing the files")
+		prefetched, local = true, true
+	}
+
+	// -max-depth counts the levels below the directory that ends up on disk, an unwrapped one is a level deeper in the
+	// DAG than the CID directory
+	maxDepth := *flagMaxDepth
+	if maxDepth > 0 {
+		maxDepth += writeDepth
+	}
+	writer := &EntryWriter{MaxDepth: maxDepth, ListDepth: listDepth, AddExt: *flagAddExt, Rename: renames, Source: writeSource, root: listRoot}
+	writer.FirstByte = func() { timings.Since("first byte", fetchStarted) }
+	if *flagManifestOut != "" {
+		writer.Manifest = &DownloadManifest{}
+	}
+	if *flagStallTimeout > 0 && !local {
+		watchCtx, stopWatching := context.WithCancel(ctx)
+		go WatchForStalls(watchCtx, ipfsA, testCID, &writer.Written, *flagStallTimeout)
+		defer stopWatching()
+	}
+	// the bar has to be gone before anything else is printed, so stopping waits for it
+	stopProgress := func() {}
+	if size, err := rootNode.Size(); showProgress && err == nil {
+		switch {
+		case prefetched:
+			// the blocks are all here, what is left to watch is the disk
+			stopProgress = StartProgress(ctx, "writing", "Wrote", writer.Written.Load, size, false)
+		case inBlocks && node != nil:
+			stopProgress = StartProgress(ctx, "downloading", "Downloaded", BlocksReceived(node), -1, true)
+		default:
+			stopProgress = StartProgress(ctx, "downloading", "Downloaded", writer.Written.Load, size, false)
+		}
+	}
+
+	// with -max-depth only part of the DAG is written, fetching all of it ahead would defeat the limit
+	if *flagDagConcurrency > 1 && *flagMaxDepth == 0 && !local && node != nil {
+		prefetchCtx, stopPrefetch := context.WithCancel(ctx)
+		defer stopPrefetch()
+		// a block that can't be fetched fails the writer as well, which reports it for the entry it belongs to
+		go PrefetchDag(prefetchCtx, node, cidFromString, *flagDagConcurrency)
+	}
+
+	err = writer.WriteTo(writeNode, filepath.Clean(outputPath), writeDepth)
+	stopProgress()
+	if err == nil {
+		timings.Since("fetch", fetchStarted)
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		// the output didn't exist before, WriteTo refuses to overwrite, so everything there is our partial download
+		os.RemoveAll(outputPath)
+		return "", writer.Written.Load(), fmt.Errorf("not enough disk space to write %s, removed the partial download: %w", outputPath, err)
+	}
 	if err != nil {
-		panic(fmt.Errorf("error: %s", err))
-	} else {
-		fmt.Printf("Wrote the files to %s\n", outputPath)
+		return "", writer.Written.Load(), err
+	}
+	if len(writer.Failed) > 0 {
+		failed := RetryFailedEntries(ctx, ipfsA, testCID, writer.Failed, writer.Manifest)
+		if len(failed) > 0 {
+			fmt.Fprintf(output.Status, "%d entries could not be fetched:\n", len(failed))
+			for _, entry := range failed {
+				fmt.Fprintf(output.Status, "  %s: %s\n", entry.Path, entry.Err)
+			}
+			return "", writer.Written.Load(), fmt.Errorf("%d entries of %s are missing: %w", len(failed), outputPath, failed[0].Err)
+		}
+		fmt.Fprintln(output.Status, "All entries fetched on retry")
+	}
+	if writer.Listed == 0 {
+		fmt.Fprintln(output.Status, "CID has no entries, it is an empty directory or file")
+	}
+	fmt.Fprintf(output.Status, "Wrote the files to %s\n", outputPath)
+	if writer.Manifest != nil {
+		if err := writer.Manifest.Write(ctx, ipfsA, testCID, *flagManifestOut); err != nil {
+			return outputPath, writer.Written.Load(), err
+		}
+	}
+	if *flagJsonProgress {
+		EmitEvent("done", map[string]any{"cid": cidStr, "path": outputPath})
 	}
 
-	return outputPath, err, 100
+	return outputPath, writer.Written.Load(), nil
 }
 
 func main() {
 
-	var flagFilePath string
-	flag.StringVar(&flagFilePath, "f", "", "a string path var") // filepath cli flag set
+	var flagFilePaths StringList
+	flag.Var(&flagFilePaths, "f", "file or directory to upload and seed, repeat it with -car to bundle several into one CAR file") // filepath cli flag set
 
 	var flagCid string
-	flag.StringVar(&flagCid, "c", "", "a string cid var") // cid cli flag set
+	flag.StringVar(&flagCid, "c", "", "CID or /ipns/ name to download, more CIDs can follow the flags") // cid cli flag set
+
+	var flagKeys string
+	flag.StringVar(&flagKeys, "keys", "", "manage IPNS keys of the -repo: list, gen <name> or rm <name>")
+
+	var flagImport bool
+	flag.BoolVar(&flagImport, "import", false, "add and pin -f into the -repo without going online, then exit")
+
+	var flagImportCar string
+	flag.StringVar(&flagImportCar, "import-car", "", "import and pin the blocks of this CAR file, printing its root CID(s)")
+
+	var flagSeed bool
+	flag.BoolVar(&flagSeed, "seed", false, "keep seeding the content after -import-car")
+
+	var flagPin string
+	flag.StringVar(&flagPin, "pin", "", "pin this CID or a path below one, like /ipfs/<cid>/photos, in the -repo and exit (missing blocks are fetched)")
+
+	var flagPins bool
+	flag.BoolVar(&flagPins, "pins", false, "list the pins of the -repo with their -pin-name labels and exit")
+
+	var flagUnpin string
+	flag.StringVar(&flagUnpin, "unpin", "", "remove the pin with this -pin-name label or CID from the -repo, together with its labels")
+
+	var flagUnseed string
+	flag.StringVar(&flagUnseed, "unseed", "", "remove this CID from the -seed-file, its content stays pinned in the repo")
 
+	var flagTree bool
+	flag.BoolVar(&flagTree, "tree", false, "print the directory tree of the -c CID with file sizes instead of downloading it (-max-depth limits the levels)")
+	var flagLinks bool
+	flag.BoolVar(&flagLinks, "links", false, "print the raw DAG links (child CIDs) of the -c CID instead of downloading it")
+
+	var flagDagGet string
+	var flagBlockGet string
+	var flagCidOf string
+	var flagVerifyFile string
+	flag.StringVar(&flagVerifyFile, "verify-file", "", "check offline that this local file or directory has the content of the -c CID, trying the usual ways of adding it unless -layout and -chunker are given")
+	var flagToMemory bool
+	var flagMaxMemory string
+	var flagBlockPut string
+	var flagBlockCodec string
+	var flagBlockHash string
+	var flagBlockPin bool
+	flag.StringVar(&flagDagGet, "dag-get", "", "fetch the block of this CID and print it as JSON (dag-cbor, dag-json, dag-pb) or as hex (raw) instead of reading it as a file")
+	flag.StringVar(&flagBlockGet, "block-get", "", "fetch only the block of this CID and write its raw bytes to the -o file (or <dir>/<cid>), waiting up to -block-timeout (default 1m)")
+	flag.StringVar(&flagCidOf, "cid-of", "", "print the CID an upload of this file or directory would get with the current -chunker and -layout, offline and without storing it; with a CID after the flags it checks the file against it like -verify-file")
+	flag.BoolVar(&flagToMemory, "to-memory", false, "fetch the single file of the -c CID into memory and write it to stdout once complete, nothing is written to disk")
+	flag.StringVar(&flagMaxMemory, "max-memory", "16MB", "largest file -to-memory accepts")
+	flag.StringVar(&flagBlockPut, "block-put", "", "store the bytes of this file as a single block, print its CID and exit (no chunking, at most 2MiB)")
+	flag.StringVar(&flagBlockCodec, "block-codec", "raw", "CID codec of the -block-put block, e.g. raw, dag-pb, dag-cbor or dag-json")
+	flag.StringVar(&flagBlockHash, "block-hash", "sha2-256", "hash function of the -block-put block, e.g. sha2-256, sha2-512 or blake3")
+	flag.BoolVar(&flagBlockPin, "block-pin", false, "pin the -block-put block in the -repo")
+
+	var flagWorkers int
+	flag.IntVar(&flagWorkers, "workers", 4, "how many CIDs to download at the same time when several are given")
+
+	var flagMount string
+	flag.StringVar(&flagMount, "mount", "", "mount the -c CID read-only at this directory and fetch files only when they are read")
+
+	var flagMonitor bool
+	flag.BoolVar(&flagMonitor, "monitor", false, "check every -interval whether the -c CID can still be retrieved, Ctrl+C prints a summary")
+
+	var flagInterval time.Duration
+	flag.DurationVar(&flagInterval, "interval", 5*time.Minute, "time between two -monitor checks")
+
+	var flagEstimate bool
+	flag.BoolVar(&flagEstimate, "estimate", false, "only report how many blocks -f would be split into with the current -chunker and -layout, without uploading")
+
+	var flagListPlugins bool
+	flag.BoolVar(&flagListPlugins, "list-plugins", false, "load the kubo plugins, print which ones are available and exit")
+	var flagSelftest bool
+	flag.BoolVar(&flagSelftest, "selftest", false, "check that plugins, repo and node work on this machine, then exit")
+
+	flag.Usage = PrintHelp
 	flag.Parse()
+	flagFilePath := ""
+	if len(flagFilePaths) > 0 {
+		flagFilePath = flagFilePaths[0]
+	}
+
+	// the CID of an upload or the file of -to-memory is all that goes to stdout, everything else is printed to stderr
+	if *flagStdoutCid || flagToMemory {
+		output.Results = os.Stdout
+		output.Status = os.Stderr
+		// kubo and the libraries below it print on their own, they have to keep off stdout as well
+		os.Stdout = os.Stderr
+	}
+	if err := SetupTransferId(); err != nil {
+		Exit(err)
+	}
 
-	if flagCid != "" || flagFilePath != "" {
-		if flagCid != "" {
-			DownloadFromCid(flagCid)
+	if *flagRepoRepair && *flagRepo == "" {
+		Exit(UsageError{errors.New("-repo-repair needs a -repo, a temporary repo is created anew every run")})
+	}
+
+	if flagSelftest {
+		if !SelfTest() {
+			os.Exit(1)
+		}
+	} else if flagListPlugins {
+		err := ListPlugins()
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagImport {
+		_, err := ImportFiles(*flagRepo, flagFilePath)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagCidOf != "" {
+		if flag.NArg() > 1 {
+			Exit(UsageError{errors.New("-cid-of compares with a single CID")})
+		}
+		err := PrintCidOf(flagCidOf, flag.Arg(0))
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagEstimate {
+		err := EstimateUpload(flagFilePath)
+		if err != nil {
+			Exit(err)
+		}
+	} else if *flagSeedCar != "" {
+		err := SeedCarFile(*flagSeedCar)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagImportCar != "" {
+		err := ImportCarFile(flagImportCar, flagSeed)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagMonitor {
+		err := MonitorCid(flagCid, flagInterval)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagMount != "" {
+		err := MountCid(flagMount, flagCid)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagTree {
+		err := PrintTree(flagCid)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagLinks {
+		err := PrintLinks(flagCid)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagDagGet != "" {
+		err := PrintDagNode(flagDagGet)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagVerifyFile != "" {
+		if flagCid == "" || flag.NArg() > 0 {
+			Exit(UsageError{errors.New("-verify-file needs exactly one CID to compare with, given with -c")})
+		}
+		err := PrintCidOf(flagVerifyFile, flagCid)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagToMemory {
+		if flagCid == "" || flag.NArg() > 0 {
+			Exit(UsageError{errors.New("-to-memory needs exactly one CID, given with -c")})
+		}
+		err := FetchToMemory(flagCid, flagMaxMemory)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagBlockGet != "" {
+		err := GetBlock(flagBlockGet)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagBlockPut != "" {
+		err := PutBlock(flagBlockPut, flagBlockCodec, flagBlockHash, flagBlockPin)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagPin != "" {
+		err := PinPath(flagPin)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagPins {
+		err := ListPins(*flagRepo)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagUnpin != "" {
+		err := Unpin(*flagRepo, flagUnpin)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagUnseed != "" {
+		if *flagSeedFile == "" {
+			Exit(UsageError{errors.New("-unseed needs the -seed-file to remove the CID from")})
+		}
+		err := UnseedCid(*flagSeedFile, flagUnseed)
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagKeys != "" {
+		err := ManageKeys(*flagRepo, flagKeys, flag.Arg(0))
+		if err != nil {
+			Exit(err)
+		}
+	} else if flagFilePath != "" && *flagCar != "" {
+		err := BundleToCar(flagFilePaths, *flagCar)
+		if err != nil {
+			Exit(err)
+		}
+	} else if len(flagFilePaths) > 1 {
+		Exit(UsageError{errors.New("several -f inputs are only bundled into a -car file, upload them as one directory otherwise")})
+	} else if flagCid != "" || flagFilePath != "" {
+		if flagCid != "" && flag.NArg() > 0 {
+			// more CIDs can follow the flags: -c cid1 cid2 cid3
+			err := DownloadManyFromCids(append([]string{flagCid}, flag.Args()...), flagWorkers)
+			if err != nil {
+				Exit(err)
+			}
+		} else if flagCid != "" {
+			_, err, _ := DownloadFromCid(flagCid)
+			if err != nil {
+				Exit(err)
+			}
 		} else if flagFilePath != "" {
-			UploadFiles(flagFilePath)
+			_, err := UploadFiles(flagFilePath)
+			if err != nil {
+				Exit(err)
+			}
+		}
+	} else if *flagSeedFile != "" {
+		err := SeedFromFile(*flagSeedFile)
+		if err != nil {
+			Exit(err)
 		}
 	} else {
-		fmt.Println("Use flags -f \"example.jpg\" or -c \"exampleCid\" to share files for example:\n./fsg -f \"example.jpg\"\nor to download files\n./fsg -c \"exampleCid\"")
+		fmt.Fprintln(output.Status, "Use flags -f \"example.jpg\" or -c \"exampleCid\" to share files for example:\n./fsg -f \"example.jpg\"\nor to download files\n./fsg -c \"exampleCid\"\nRun ./fsg -h for all options")
+		os.Exit(ExitUsage)
+	}
+
+	if *flagBugReport != "" {
+		if err := bugReport.Write(nil); err != nil {
+			fmt.Fprintln(output.Status, err)
+			os.Exit(ExitFailure)
+		}
 	}
 }
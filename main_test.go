@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Returns an in-memory node that is closed when the test ends.
+func newTestNode(t testing.TB) (context.Context, icore.CoreAPI) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ipfsA, node, err := NewMemoryNode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+	return ctx, ipfsA
+}
+
+// Adds inputPath like an upload does, then downloads the CID again like a download does and returns where it was
+// written to.
+func roundTrip(t *testing.T, inputPath string) string {
+	t.Helper()
+	ctx, ipfsA := newTestNode(t)
+
+	someFile, err := GetUploadNode(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := AddOffline(ctx, ipfsA, someFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootNode, err := ipfsA.Unixfs().Get(ctx, path.FromCid(added.RootCid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputPath := filepath.Join(t.TempDir(), added.RootCid().String())
+	writer := &EntryWriter{}
+	if err := writer.WriteTo(rootNode, outputPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(writer.Failed) > 0 {
+		t.Fatalf("entries failed: %v", writer.Failed)
+	}
+	return outputPath
+}
+
+func TestRoundTripEmptyFile(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(inputPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// single files are wrapped in a directory that only holds them
+	info, err := os.Stat(filepath.Join(roundTrip(t, inputPath), "empty.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.Mode().IsRegular() || info.Size() != 0 {
+		t.Fatalf("want an empty regular file, got %s of %d bytes", info.Mode(), info.Size())
+	}
+}
+
+func TestRoundTripEmptyDirectory(t *testing.T) {
+	inputPath := filepath.Join(t.TempDir(), "empty")
+	if err := os.Mkdir(inputPath, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	outputPath := roundTrip(t, inputPath)
+	info, err := os.Stat(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Fatalf("want a directory, got %s", info.Mode())
+	}
+	entries, err := os.ReadDir(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("want an empty directory, got %d entries", len(entries))
+	}
+}
+
+// Sets the flag behind ptr to value until the test ends.
+func setFlag[T any](t testing.TB, ptr *T, value T) {
+	previous := *ptr
+	*ptr = value
+	t.Cleanup(func() { *ptr = previous })
+}
+
+// Returns the CID an upload of inputPath gets with -layout set to layout, added on a fresh node.
+func cidWithLayout(t *testing.T, inputPath string, layout string) string {
+	t.Helper()
+	setFlag(t, flagLayout, layout)
+
+	ctx, ipfsA := newTestNode(t)
+	someFile, err := GetUploadNode(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := AddOffline(ctx, ipfsA, someFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return added.RootCid().String()
+}
+
+func TestLayoutChangesCid(t *testing.T) {
+	// 4 chunks of the default chunker, the same bytes on every run
+	content := make([]byte, 4*256*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+	inputPath := filepath.Join(t.TempDir(), "multi.bin")
+	if err := os.WriteFile(inputPath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	balanced := cidWithLayout(t, inputPath, "balanced")
+	trickle := cidWithLayout(t, inputPath, "trickle")
+	if balanced == trickle {
+		t.Fatalf("balanced and trickle layout both gave %s", balanced)
+	}
+	for layout, want := range map[string]string{"balanced": balanced, "trickle": trickle} {
+		if got := cidWithLayout(t, inputPath, layout); got != want {
+			t.Errorf("-layout %s gave %s, then %s", layout, want, got)
+		}
+	}
+}
+
+// Downloads a CID that wraps the directory top, which holds a.txt and sub/b.txt, with -max-depth 1 and the flags
+// set. Returns the -o directory it was written into and the CID.
+func downloadWrappedDir(t *testing.T, outputNameFromCid bool, flatten bool) (string, string) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ipfsA, node, err := NewMemoryNode(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { node.Close() })
+
+	wrapped := files.NewMapDirectory(map[string]files.Node{
+		"top": files.NewMapDirectory(map[string]files.Node{
+			"a.txt": files.NewBytesFile([]byte("a")),
+			"sub": files.NewMapDirectory(map[string]files.Node{
+				"b.txt": files.NewBytesFile([]byte("b")),
+			}),
+		}),
+	})
+	added, err := AddOffline(ctx, ipfsA, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := t.TempDir()
+	setFlag(t, flagOutput, outputDir)
+	setFlag(t, flagMaxDepth, 1)
+	setFlag(t, flagOutputNameFromCid, outputNameFromCid)
+	setFlag(t, flagFlatten, flatten)
+	if _, _, err := FetchCid(ctx, ipfsA, node, added.RootCid().String(), false); err != nil {
+		t.Fatal(err)
+	}
+	return outputDir, added.RootCid().String()
+}
+
+// -max-depth 1 writes the entries of the directory that ends up on disk, however it was unwrapped.
+func checkMaxDepthOne(t *testing.T, topPath string) {
+	t.Helper()
+	if _, err := os.Stat(filepath.Join(topPath, "a.txt")); err != nil {
+		t.Fatalf("the first level wasn't written: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(topPath, "sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("want sub created empty, got %d entries", len(entries))
+	}
+}
+
+func TestMaxDepthUnwrapped(t *testing.T) {
+	outputDir, _ := downloadWrappedDir(t, false, false)
+	checkMaxDepthOne(t, filepath.Join(outputDir, "top"))
+}
+
+func TestMaxDepthFlatten(t *testing.T) {
+	outputDir, rootCid := downloadWrappedDir(t, true, true)
+	checkMaxDepthOne(t, filepath.Join(outputDir, rootCid))
+}
+
+// A file on a disk that fills up after room bytes: the write that doesn't fit is cut short with ENOSPC.
+type fullDiskFile struct {
+	*os.File
+	room int
+}
+
+func (f *fullDiskFile) Write(b []byte) (int, error) {
+	if len(b) <= f.room {
+		f.room -= len(b)
+		return f.File.Write(b)
+	}
+	n, _ := f.File.Write(b[:f.room])
+	f.room = 0
+	return n, syscall.ENOSPC
+}
+
+// Returns an EntryWriter whose files fill the disk after room bytes.
+func fullDiskWriter(room int) *EntryWriter {
+	return &EntryWriter{Create: func(name string) (io.WriteCloser, error) {
+		f, err := os.OpenFile(name, os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0o666)
+		if err != nil {
+			return nil, err
+		}
+		return &fullDiskFile{f, room}, nil
+	}}
+}
+
+func TestShortWriteRemovesPartialFile(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "big.bin")
+	writer := fullDiskWriter(1000)
+
+	err := writer.WriteTo(files.NewBytesFile(bytes.Repeat([]byte("x"), 64*1024)), outputPath, 0)
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("want ENOSPC, got %v", err)
+	}
+	if _, err := os.Stat(outputPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("the partial file is still there: %v", err)
+	}
+	if written := writer.Written.Load(); written != 1000 {
+		t.Fatalf("want the 1000 bytes that fit counted, got %d", written)
+	}
+}
+
+func TestShortWriteStopsDirectory(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "dir")
+	writer := fullDiskWriter(1000)
+	dir := files.NewMapDirectory(map[string]files.Node{
+		"a.bin": files.NewBytesFile(bytes.Repeat([]byte("a"), 64*1024)),
+		"b.bin": files.NewBytesFile(bytes.Repeat([]byte("b"), 64*1024)),
+	})
+
+	// a full disk isn't one file that failed, the rest of the directory wouldn't fit either
+	err := writer.WriteTo(dir, outputPath, 0)
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("want ENOSPC, got %v", err)
+	}
+	if len(writer.Failed) > 0 {
+		t.Fatalf("want the download stopped, got failed entries %v", writer.Failed)
+	}
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if _, err := os.Stat(filepath.Join(outputPath, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("%s is still there: %v", name, err)
+		}
+	}
+}
+
+// The empty directory, every kubo node has it as the root of its MFS and announces it.
+var emptyDirCid = cid.MustParse("QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn")
+
+// Measures how long the DHT takes to name the first provider of a CID, which is what a download waits for before
+// its first byte, with the default client and with -fast-dht. Needs internet access and skips without it. The
+// accelerated client is only fast once its first crawl of the DHT finished, which takes minutes, so give it a
+// -benchtime that covers that, e.g. go test -run - -bench FirstProvider -benchtime 5m
+func BenchmarkFirstProvider(b *testing.B) {
+	b.Run("default", func(b *testing.B) { benchmarkFirstProvider(b, false) })
+	b.Run("fast-dht", func(b *testing.B) { benchmarkFirstProvider(b, true) })
+}
+
+func benchmarkFirstProvider(b *testing.B, fastDht bool) {
+	previousFastDht, previousExp := *flagFastDht, *flagExp
+	*flagFastDht, *flagExp = fastDht, fastDht
+	b.Cleanup(func() { *flagFastDht, *flagExp = previousFastDht, previousExp })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ipfsA, node, err := SpawnInMemory(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer node.Close()
+
+	// lookups before bootstrapping found any peers only measure the wait for them
+	for deadline := time.Now().Add(30 * time.Second); ; time.Sleep(time.Second) {
+		if peers, err := ipfsA.Swarm().Peers(ctx); err == nil && len(peers) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			b.Skip("no peers after 30s, the benchmark needs internet access")
+		}
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookupCtx, cancelLookup := context.WithTimeout(ctx, time.Minute)
+		providers, err := ipfsA.Dht().FindProviders(lookupCtx, path.FromCid(emptyDirCid), options.Dht.NumProviders(1))
+		if err != nil {
+			cancelLookup()
+			b.Fatal(err)
+		}
+		_, found := <-providers
+		cancelLookup()
+		if !found {
+			b.Fatalf("no provider of %s within a minute", emptyDirCid)
+		}
+	}
+}
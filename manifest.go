@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/boxo/path"
+	icore "github.com/ipfs/kubo/core/coreiface"
+)
+
+// What -manifest-out writes after a download: every file written with its path below the root CID, size and CID.
+type DownloadManifest struct {
+	Root      string          `json:"root"`
+	TotalSize int64           `json:"totalSize"`
+	Files     []ManifestEntry `json:"files"`
+
+	mu sync.Mutex
+}
+
+type ManifestEntry struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	Cid  string `json:"cid"`
+
+	source string
+}
+
+// Records a file the EntryWriter wrote, source is its path below the root CID ("" for the root itself, which is
+// named like the file written then).
+func (m *DownloadManifest) Add(source string, fpath string, size int64) {
+	name := source
+	if source == "" {
+		name = filepath.Base(fpath)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Files = append(m.Files, ManifestEntry{Path: name, Size: size, source: source})
+	m.TotalSize += size
+}
+
+// Looks up the CID of every recorded file below root and writes the manifest to manifestPath. The blocks are in the
+// repo after the download, nothing is fetched for it.
+func (m *DownloadManifest) Write(ctx context.Context, ipfsA icore.CoreAPI, root path.ImmutablePath, manifestPath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.Root = root.RootCid().String()
+	for i, entry := range m.Files {
+		entryPath := path.Path(root)
+		if entry.source != "" {
+			var err error
+			entryPath, err = path.Join(root, strings.Split(entry.source, "/")...)
+			if err != nil {
+				return err
+			}
+		}
+		resolved, _, err := ipfsA.ResolvePath(ctx, entryPath)
+		if err != nil {
+			return fmt.Errorf("could not resolve %s for the manifest: %w", entryPath, err)
+		}
+		m.Files[i].Cid = resolved.RootCid().String()
+	}
+	sort.Slice(m.Files, func(i, j int) bool { return m.Files[i].Path < m.Files[j].Path })
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestPath, append(content, '\n'), 0o644); err != nil {
+		return fmt.Errorf("could not write the manifest: %w", err)
+	}
+	fmt.Fprintf(output.Status, "Wrote the manifest of %d files to %s\n", len(m.Files), manifestPath)
+	return nil
+}
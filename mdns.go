@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/ipfs/kubo/core"
+	"github.com/libp2p/go-libp2p/core/network"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Prints every peer the node connects to over a LAN or loopback address, once per peer, until ctx is done. mDNS
+// dials the peers it finds right away, so these are the local peers it discovered (or -peers-file peers on the LAN).
+func ReportLocalPeers(ctx context.Context, node *core.IpfsNode) {
+	var reported sync.Map
+	notifee := &network.NotifyBundle{
+		ConnectedF: func(_ network.Network, conn network.Conn) {
+			if !manet.IsPrivateAddr(conn.RemoteMultiaddr()) {
+				return
+			}
+			if _, seen := reported.LoadOrStore(conn.RemotePeer(), true); !seen {
+				fmt.Fprintf(output.Status, "Found local peer %s at %s\n", conn.RemotePeer(), conn.RemoteMultiaddr())
+			}
+		},
+	}
+	node.PeerHost.Network().Notify(notifee)
+	// mDNS starts with the node, it may have connected before anyone was listening
+	for _, conn := range node.PeerHost.Network().Conns() {
+		notifee.Connected(node.PeerHost.Network(), conn)
+	}
+	go func() {
+		<-ctx.Done()
+		node.PeerHost.Network().StopNotify(notifee)
+	}()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/kubo/config"
+)
+
+// Below this a node doesn't get through bootstrapping without the GC running all the time.
+const minMemLimit = 64 << 20
+
+// Parses -mem-limit, 0 when it isn't set.
+func MemLimit() (uint64, error) {
+	if *flagMemLimit == "" {
+		return 0, nil
+	}
+	limit, err := humanize.ParseBytes(*flagMemLimit)
+	if err != nil {
+		return 0, UsageError{fmt.Errorf("invalid -mem-limit %q, use a size like 512MB: %w", *flagMemLimit, err)}
+	}
+	if limit < minMemLimit {
+		return 0, UsageError{fmt.Errorf("-mem-limit %s is too low, a node needs at least %s", humanize.IBytes(limit), humanize.IBytes(minMemLimit))}
+	}
+	return limit, nil
+}
+
+// Makes the Go runtime collect garbage harder as the process gets close to limit, the same as GOMEMLIMIT does. It is
+// a soft limit, the process can still go above it when the live data doesn't fit.
+func SetMemLimit(limit uint64) {
+	if limit > 0 {
+		debug.SetMemoryLimit(int64(limit))
+	}
+}
+
+// Sizes the parts of cfg that grow with the traffic to limit: the libp2p resource manager gets half of it, connections
+// and bitswap buffers and workers shrink along. Values already lower, e.g. from -low-power, are kept. The blockstore
+// caches of kubo (the bloom filter is off, the ARC cache holds only CIDs) aren't configurable and stay as they are.
+func ApplyMemLimit(cfg *config.Config, limit uint64) {
+	cfg.Swarm.ResourceMgr.MaxMemory = config.NewOptionalString(humanize.IBytes(limit / 2))
+
+	// every connection costs buffers for its streams and muxer, about 4MiB when busy
+	highWater := clamp(int64(limit/(4<<20)), 16, config.DefaultConnMgrHighWater)
+	if highWater < cfg.Swarm.ConnMgr.HighWater.WithDefault(config.DefaultConnMgrHighWater) {
+		cfg.Swarm.ConnMgr.HighWater = config.NewOptionalInteger(highWater)
+		cfg.Swarm.ConnMgr.LowWater = config.NewOptionalInteger(highWater / 2)
+	}
+
+	// the defaults are 1MiB in flight per peer and 128 blockstore workers, made for servers
+	if cfg.Internal.Bitswap == nil {
+		cfg.Internal.Bitswap = &config.InternalBitswap{}
+	}
+	bitswap := cfg.Internal.Bitswap
+	bitswap.MaxOutstandingBytesPerPeer = *config.NewOptionalInteger(clamp(int64(limit/256), 64<<10, 1<<20))
+	bitswap.EngineBlockstoreWorkerCount = *config.NewOptionalInteger(clamp(int64(limit/(8<<20)), 8, 128))
+	if limit < 256<<20 {
+		bitswap.TaskWorkerCount = *config.NewOptionalInteger(4)
+		bitswap.EngineTaskWorkerCount = *config.NewOptionalInteger(4)
+	}
+}
+
+func clamp(value, low, high int64) int64 {
+	return min(max(value, low), high)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+)
+
+// Fetches the single file of cidStr into memory and writes it to the results output only once all of it arrived, nothing
+// touches the disk. A file larger than maxMemory (like 16MB) is refused, before fetching when its size is known
+// upfront. A CID wrapping a single file, like fsg uploads do, gives that file.
+func FetchToMemory(cidStr string, maxMemory string) error {
+	limit, err := humanize.ParseBytes(maxMemory)
+	if err != nil {
+		return UsageError{fmt.Errorf("invalid -max-memory %q, use a size like 16MB: %w", maxMemory, err)}
+	}
+	if err := CheckStrictInputs(cidStr); err != nil {
+		return err
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	PrintShareExpiry(cidStr)
+	ConnectHintedPeers(ctx, ipfsA, cidStr)
+	if name, _, _ := strings.Cut(strings.TrimSpace(cidStr), "?"); strings.HasPrefix(name, "/ipns/") {
+		resolvedCid, err := ResolveName(ctx, ipfsA, name)
+		if err != nil {
+			return fmt.Errorf("could not resolve %s: %w", name, err)
+		}
+		cidStr = resolvedCid.String()
+	}
+	c, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+	if err := CheckFileCodec(c); err != nil {
+		return UsageError{err}
+	}
+
+	nd, err := ipfsA.Unixfs().Get(ctx, path.FromCid(c))
+	if err != nil {
+		return err
+	}
+	if _, entry, ok := SingleEntry(nd); ok {
+		nd = entry
+	}
+	file, ok := nd.(files.File)
+	if !ok {
+		return UsageError{fmt.Errorf("%s is a directory, -to-memory takes a single file", c)}
+	}
+	defer file.Close()
+	if size, err := file.Size(); err == nil && uint64(size) > limit {
+		return fmt.Errorf("%s is %s, more than the -max-memory of %s", c, FormatSize(uint64(size)), FormatSize(limit))
+	}
+
+	// the size is only what the root block claims, the limit holds for what actually arrives
+	var content bytes.Buffer
+	read, err := io.Copy(&content, io.LimitReader(file, int64(limit)+1))
+	if err != nil {
+		return fmt.Errorf("could not fetch %s: %w", c, err)
+	}
+	if uint64(read) > limit {
+		return fmt.Errorf("%s is larger than the -max-memory of %s", c, FormatSize(limit))
+	}
+	return output.WriteResult(content.Bytes())
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/repo"
+	"github.com/pbnjay/memory"
+)
+
+// Spawns an online node for -minimal-blockstore whose repo lives in memory: blocks, datastore and keys are gone on
+// exit and no temporary directory is created. The config flags apply like for a temporary repo.
+func SpawnInMemory(ctx context.Context) (icore.CoreAPI, *core.IpfsNode, error) {
+	if err := SetupPluginsOnce(); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	// -experimental turns these on, they reference files on disk through a file manager a repo in memory doesn't have
+	cfg.Experimental.FilestoreEnabled = false
+	cfg.Experimental.UrlstoreEnabled = false
+
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online:  true,
+		Routing: NodeRouting(),
+		Repo: &repo.Mock{
+			C: *cfg,
+			D: dssync.MutexWrap(datastore.NewMapDatastore()),
+			K: keystore.NewMemKeystore(),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	api, err := coreapi.NewCoreAPI(node)
+	return api, node, err
+}
+
+// With -minimal-blockstore every block of a download stays in memory until fsg exits, so the download has to fit
+// into the free memory of the system, and below -mem-limit when one is set. Where free memory can't be looked up
+// only -mem-limit is checked.
+func CheckFreeMemory(nd files.Node) error {
+	size, err := nd.Size()
+	if err != nil {
+		return err
+	}
+	free := memory.FreeMemory()
+	if limit, _ := MemLimit(); limit > 0 && (free == 0 || limit < free) {
+		free = limit
+	}
+	if free > 0 && uint64(size) > free {
+		return fmt.Errorf("not enough memory for -minimal-blockstore: the download needs %s, only %s are free, download without it to keep the blocks on disk", FormatSize(uint64(size)), FormatSize(free))
+	}
+	return nil
+}
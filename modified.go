@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+)
+
+// Parses a -modified-since value, either a duration back from now like 24h or a time like 2024-05-01 or
+// 2024-05-01T15:04:05Z.
+func ParseModifiedSince(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a duration like 24h nor a time like 2024-05-01 or 2024-05-01T15:04:05Z", value)
+}
+
+// Returns the slash separated paths below dirPath of files modified after since, together with the directories
+// leading to them, mapped to the size of what is kept there ("" is dirPath itself). Like the add it skips hidden
+// files unless -include-hidden is set and doesn't follow symlinks.
+func ModifiedPaths(dirPath string, since time.Time) (map[string]int64, error) {
+	keep := map[string]int64{}
+	err := filepath.WalkDir(dirPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dirPath {
+			return nil
+		}
+		if !*flagIncludeHidden && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().After(since) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(dirPath, p)
+		if err != nil {
+			return err
+		}
+		for relPath = filepath.ToSlash(relPath); relPath != "."; relPath = path.Dir(relPath) {
+			keep[relPath] += info.Size()
+		}
+		keep[""] += info.Size()
+		return nil
+	})
+	return keep, err
+}
+
+// A directory that only shows the entries whose path is in keep (see ModifiedPaths), so directories without kept
+// files are left out.
+type modifiedDirectory struct {
+	files.Directory
+	keep map[string]int64
+	name string
+}
+
+func (d *modifiedDirectory) Size() (int64, error) {
+	return d.keep[d.name], nil
+}
+
+func (d *modifiedDirectory) Entries() files.DirIterator {
+	return &modifiedIterator{DirIterator: d.Directory.Entries(), keep: d.keep, dir: d.name}
+}
+
+type modifiedIterator struct {
+	files.DirIterator
+	keep map[string]int64
+	dir  string
+}
+
+func (it *modifiedIterator) Next() bool {
+	for it.DirIterator.Next() {
+		if _, ok := it.keep[path.Join(it.dir, it.Name())]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *modifiedIterator) Node() files.Node {
+	nd := it.DirIterator.Node()
+	if dir, ok := nd.(files.Directory); ok {
+		return &modifiedDirectory{Directory: dir, keep: it.keep, name: path.Join(it.dir, it.Name())}
+	}
+	return nd
+}
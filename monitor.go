@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Checks every interval whether cidStr can still be retrieved, until SIGINT or SIGTERM, and then prints a summary.
+// A check looks up the providers and fetches the root block, which is removed again afterwards so the next check
+// has to fetch it from the network too. If the root block was already stored locally, only providers are checked.
+func MonitorCid(cidStr string, interval time.Duration) error {
+	rootCid, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+	rootPath := path.FromCid(rootCid)
+
+	ctx, ipfsA, _, cancel, err := StartIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	offline, err := ipfsA.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		return err
+	}
+	_, err = offline.Block().Stat(ctx, rootPath)
+	fetchRoot := err != nil
+	if !fetchRoot {
+		fmt.Fprintln(output.Status, "The root block is stored locally, only provider lookups are checked")
+	}
+
+	quitChannel := make(chan os.Signal, 1)
+	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
+
+	fmt.Fprintf(output.Status, "Monitoring %s every %s, press Ctrl+C to stop\n", rootCid, interval)
+	checks, available := 0, 0
+	var totalLatency time.Duration
+	for {
+		providerCount, latency, err := CheckAvailability(ctx, ipfsA, rootPath, fetchRoot)
+		checks += 1
+		now := time.Now().Format(time.RFC3339)
+		if err != nil {
+			fmt.Fprintf(output.Status, "%s unavailable, %d provider(s): %s\n", now, providerCount, err)
+		} else {
+			available += 1
+			totalLatency += latency
+			fmt.Fprintf(output.Status, "%s available, %d provider(s), latency %s\n", now, providerCount, latency.Round(time.Millisecond))
+		}
+
+		select {
+		case sig := <-quitChannel:
+			fmt.Fprintf(output.Status, "\nStopped monitoring: received %s\n", sig)
+			fmt.Fprintf(output.Status, "%d check(s), available %.1f%% of the time", checks, float64(available)*100/float64(checks))
+			if available > 0 {
+				fmt.Fprintf(output.Status, ", average latency %s", (totalLatency / time.Duration(available)).Round(time.Millisecond))
+			}
+			fmt.Fprintln(output.Status)
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Runs a single availability check of p: a provider lookup and, with fetchRoot, fetching its root block. Latency is
+// how long the fetch took, or the lookup when the root block isn't fetched. Without fetchRoot p counts as available
+// when at least one provider was found.
+func CheckAvailability(ctx context.Context, ipfsA icore.CoreAPI, p path.Path, fetchRoot bool) (providerCount int, latency time.Duration, err error) {
+	start := time.Now()
+	providerCount, err = CountProviders(ctx, ipfsA, p, *flagProvidersTimeout)
+	if err != nil {
+		return 0, 0, fmt.Errorf("provider lookup failed: %w", err)
+	}
+	if !fetchRoot {
+		if providerCount == 0 {
+			return 0, 0, fmt.Errorf("no providers found within %s", *flagProvidersTimeout)
+		}
+		return providerCount, time.Since(start), nil
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, *flagProvidersTimeout)
+	defer cancel()
+	start = time.Now()
+	block, err := ipfsA.Block().Get(fetchCtx, p)
+	if err != nil {
+		return providerCount, 0, fmt.Errorf("could not fetch the root block: %w", err)
+	}
+	_, err = io.Copy(io.Discard, block)
+	latency = time.Since(start)
+	if err != nil {
+		return providerCount, 0, fmt.Errorf("could not fetch the root block: %w", err)
+	}
+
+	// otherwise every later check would just read it from the local blockstore
+	ipfsA.Block().Rm(ctx, p)
+	return providerCount, latency, nil
+}
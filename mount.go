@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Mounts IPFS read-only at mountDir and keeps it mounted until SIGINT or SIGTERM, so the content of cidStr can be
+// browsed with ls and cat under mountDir/<cid>. Blocks are only fetched when a file or directory is actually read.
+func MountCid(mountDir string, cidStr string) error {
+	rootCid, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+	if err := CheckFileCodec(rootCid); err != nil {
+		return UsageError{err}
+	}
+	mountDir, err = filepath.Abs(mountDir)
+	if err != nil {
+		return err
+	}
+
+	_, _, node, cancel, err := StartIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	unmount, err := MountIpfs(node, mountDir)
+	if err != nil {
+		return fmt.Errorf("could not mount %s: %w", mountDir, err)
+	}
+
+	// the mount serves every CID, listing its root isn't possible, so point straight at ours
+	fmt.Fprintf(output.Status, "Mounted read-only, browse the content at %s\n", filepath.Join(mountDir, rootCid.String()))
+	fmt.Fprintln(output.Status, "Press Ctrl+C to unmount")
+
+	quitChannel := make(chan os.Signal, 1)
+	signal.Notify(quitChannel, syscall.SIGINT, syscall.SIGTERM)
+	<-quitChannel
+
+	err = unmount()
+	if err != nil {
+		return fmt.Errorf("could not unmount %s: %w", mountDir, err)
+	}
+	fmt.Fprintf(output.Status, "\nUnmounted %s\n", mountDir)
+	return nil
+}
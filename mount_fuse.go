@@ -0,0 +1,18 @@
+//go:build (linux || darwin || freebsd) && !nofuse
+
+package main
+
+import (
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/fuse/readonly"
+)
+
+// Mounts the /ipfs namespace of node at mountDir with kubo's read-only FUSE filesystem. Needs FUSE installed (fuse on
+// Linux, macFUSE on macOS).
+func MountIpfs(node *core.IpfsNode, mountDir string) (unmount func() error, err error) {
+	m, err := readonly.Mount(node, mountDir)
+	if err != nil {
+		return nil, err
+	}
+	return m.Unmount, nil
+}
@@ -0,0 +1,14 @@
+//go:build !((linux || darwin || freebsd) && !nofuse)
+
+package main
+
+import (
+	"errors"
+
+	"github.com/ipfs/kubo/core"
+)
+
+// FUSE isn't available on this platform or the build left it out with the nofuse tag.
+func MountIpfs(node *core.IpfsNode, mountDir string) (unmount func() error, err error) {
+	return nil, errors.New("this build of fsg has no FUSE support")
+}
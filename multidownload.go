@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"text/tabwriter"
+)
+
+type DownloadResult struct {
+	Cid        string
+	OutputPath string
+	Written    int64
+	Err        error
+}
+
+// Downloads all cidStrs over one shared node, at most workers of them at the same time, then prints a table of what
+// worked. Returns the error of the first failed download, if any failed.
+func DownloadManyFromCids(cidStrs []string, workers int) error {
+	if workers < 1 {
+		workers = 1
+	}
+	if *flagManifestOut != "" {
+		return UsageError{errors.New("-manifest-out describes one download, give a single CID with it")}
+	}
+	if err := CheckStrictInputs(cidStrs...); err != nil {
+		return err
+	}
+
+	ctx, ipfsA, node, cancel, err := StartIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	results := make([]DownloadResult, len(cidStrs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every job writes only its own slot of results, no locking needed. Several bars at once would draw over each
+			// other, the summary at the end reports the sizes instead
+			for i := range jobs {
+				outputPath, written, err := FetchCid(ctx, ipfsA, node, cidStrs[i], false)
+				results[i] = DownloadResult{Cid: cidStrs[i], OutputPath: outputPath, Written: written, Err: err}
+			}
+		}()
+	}
+	for i := range cidStrs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	timings.Print()
+
+	if PrintDownloadResults(results) {
+		return nil
+	}
+	for _, result := range results {
+		if result.Err != nil {
+			return fmt.Errorf("%s: %w", result.Cid, result.Err)
+		}
+	}
+	return nil
+}
+
+// Prints one line per download and returns true if all of them succeeded.
+func PrintDownloadResults(results []DownloadResult) bool {
+	succeeded := 0
+	tw := tabwriter.NewWriter(output.Status, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nCID\tSTATUS\tSIZE\tPATH")
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(tw, "%s\tfailed\t%s\t%s\n", result.Cid, FormatSize(uint64(result.Written)), result.Err)
+		} else {
+			succeeded += 1
+			fmt.Fprintf(tw, "%s\tok\t%s\t%s\n", result.Cid, FormatSize(uint64(result.Written)), result.OutputPath)
+		}
+	}
+	tw.Flush()
+
+	fmt.Fprintf(output.Status, "%d of %d downloads succeeded\n", succeeded, len(results))
+	return succeeded == len(results)
+}
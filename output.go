@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/schollz/progressbar/v3"
+)
+
+// Where fsg writes what it prints. The CLI writes to the real stdout and stderr, tests or a program wrapping fsg can
+// swap in writers of their own before anything runs.
+type Output struct {
+	// stages, listings, summaries and errors, everything meant for a person following along
+	Status io.Writer
+	// progress bars and -json-progress events
+	Progress io.Writer
+	// what scripts capture: the CID of -stdout-cid and the file of -to-memory, nil unless one of them is asked for
+	Results io.Writer
+}
+
+var output = Output{Status: os.Stdout, Progress: os.Stderr}
+
+// Writes content to Results and closes it when it can be closed. The result is all there is, closing lets a reader
+// like `| head` or $(...) finish while fsg goes on, e.g. seeding.
+func (o *Output) WriteResult(content []byte) error {
+	if o.Results == nil {
+		return nil
+	}
+	if _, err := o.Results.Write(content); err != nil {
+		return err
+	}
+	if closer, ok := o.Results.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// Whether Progress is a terminal that bars can be drawn on.
+func (o *Output) ProgressIsTerminal() bool {
+	progress := o.Progress
+	if p, ok := progress.(*prefixWriter); ok {
+		progress = p.w
+	}
+	f, ok := progress.(*os.File)
+	return ok && (isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd()))
+}
+
+// Returns a bar drawn on Progress, counting bytes or, with inBlocks, plain numbers. It looks like progressbar's
+// DefaultBytes and Default, which only draw on os.Stderr. A negative total shows a spinner.
+func (o *Output) NewProgressBar(total int64, description string, inBlocks bool) *progressbar.ProgressBar {
+	options := []progressbar.Option{
+		progressbar.OptionSetDescription(description),
+		progressbar.OptionSetWriter(o.Progress),
+		progressbar.OptionSetWidth(10),
+		progressbar.OptionThrottle(65 * time.Millisecond),
+		progressbar.OptionShowCount(),
+		progressbar.OptionOnCompletion(func() {
+			fmt.Fprint(o.Progress, "\n")
+		}),
+		progressbar.OptionSpinnerType(14),
+		progressbar.OptionFullWidth(),
+		progressbar.OptionSetRenderBlankState(true),
+	}
+	if inBlocks {
+		options = append(options, progressbar.OptionShowIts())
+	} else {
+		options = append(options, progressbar.OptionShowBytes(true))
+	}
+	return progressbar.NewOptions64(total, options...)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/libp2p/go-libp2p/core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Query parameter of a share link naming a peer that has the content, e.g. /ipfs/<cid>?peer=/ip4/1.2.3.4/tcp/4001/p2p/12D3KooW...
+const peerHintKey = "peer"
+
+// Returns the peers the ?peer= hints of link name, hints that aren't a multiaddr ending in /p2p/<id> are skipped with a
+// warning, a bad hint shouldn't stop the download.
+func PeerHints(link string) []peer.AddrInfo {
+	_, query, found := strings.Cut(strings.TrimSpace(link), "?")
+	if !found {
+		return nil
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		fmt.Fprintf(output.Status, "Warning: ignoring the hints of the link, %s\n", err)
+		return nil
+	}
+	var addrs []ma.Multiaddr
+	for _, hint := range values[peerHintKey] {
+		if _, err := ParsePeerHint(hint); err != nil {
+			fmt.Fprintf(output.Status, "Warning: ignoring the peer hint %q, %s\n", hint, err)
+			continue
+		}
+		addr, _ := ma.NewMultiaddr(hint)
+		addrs = append(addrs, addr)
+	}
+	// several hints for one peer are merged into one dial
+	peers, _ := peer.AddrInfosFromP2pAddrs(addrs...)
+	return peers
+}
+
+func ParsePeerHint(hint string) (*peer.AddrInfo, error) {
+	addr, err := ma.NewMultiaddr(hint)
+	if err != nil {
+		return nil, err
+	}
+	return peer.AddrInfoFromP2pAddr(addr)
+}
+
+// Dials the peers hinted in link before the download asks the network, between two known machines the content then
+// comes straight from the sharer instead of after a provider search.
+func ConnectHintedPeers(ctx context.Context, ipfsA icore.CoreAPI, link string) {
+	peers := PeerHints(link)
+	if len(peers) == 0 {
+		return
+	}
+	fmt.Fprintf(output.Status, "Connecting to %d peer(s) named in the link\n", len(peers))
+	ConnectPeers(ctx, ipfsA, peers)
+}
+
+// Reads a newline separated list of peer multiaddrs like /ip4/1.2.3.4/tcp/4001/p2p/12D3KooW... Blank lines and lines
+// starting with # are skipped, addresses of the same peer are merged.
+func LoadPeersFile(peersFile string) ([]peer.AddrInfo, error) {
+	f, err := os.Open(peersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var addrs []ma.Multiaddr
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		addr, err := ma.NewMultiaddr(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", peersFile, lineNumber, err)
+		}
+		addrs = append(addrs, addr)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return peer.AddrInfosFromP2pAddrs(addrs...)
+}
+
+// Dials every peer and logs whether it worked, a peer that can't be reached doesn't stop the others.
+func ConnectPeers(ctx context.Context, ipfsA icore.CoreAPI, peers []peer.AddrInfo) {
+	for _, p := range peers {
+		err := ConnectPeer(ctx, ipfsA, p)
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			fmt.Fprintf(output.Status, "Timed out connecting to peer %s after -connect-timeout %s\n", p.ID, *flagConnectTimeout)
+		} else if err != nil {
+			fmt.Fprintf(output.Status, "Could not connect to peer %s: %s\n", p.ID, err)
+		} else {
+			fmt.Fprintf(output.Status, "Connected to peer %s\n", p.ID)
+		}
+	}
+}
+
+// Dials p, giving up after -connect-timeout when it is set. Only the dial is bounded, not what is fetched from p later.
+func ConnectPeer(ctx context.Context, ipfsA icore.CoreAPI, p peer.AddrInfo) error {
+	if *flagConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *flagConnectTimeout)
+		defer cancel()
+	}
+	return ipfsA.Swarm().Connect(ctx, p)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Pins the DAG at pathStr in the -repo, which can point below a CID like /ipfs/<cid>/photos/2023. The path is
+// resolved to the CID of that entry and only its DAG is pinned, blocks missing from the repo are fetched. Prints the
+// resolved CID.
+func PinPath(pathStr string) error {
+	if *flagRepo == "" {
+		return UsageError{errors.New("-pin needs a -repo, pins of a temporary repo are gone on exit")}
+	}
+	if !strings.HasPrefix(pathStr, "/") {
+		pathStr = "/ipfs/" + pathStr
+	}
+	if *flagPinName != "" {
+		if err := ValidatePinName(*flagPinName); err != nil {
+			return err
+		}
+	}
+	p, err := path.NewPath(pathStr)
+	if err != nil {
+		return UsageError{err}
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	resolved, _, err := ipfsA.ResolvePath(ctx, p)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %w", p, err)
+	}
+	fmt.Fprintf(output.Status, "%s resolves to %s\n", p, resolved.RootCid())
+
+	err = ipfsA.Pin().Add(ctx, resolved, options.Pin.Recursive(true))
+	if err != nil {
+		return fmt.Errorf("could not pin %s: %w", resolved.RootCid(), err)
+	}
+	fmt.Fprintf(output.Status, "Pinned %s\n", path.FromCid(resolved.RootCid()))
+	if *flagPinName != "" {
+		return NamePin(*flagRepo, *flagPinName, resolved.RootCid())
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// File in the -repo that maps -pin-name labels to CIDs. Kubo's pins carry no names, so they are kept next to the
+// repo's own files.
+const pinNamesFile = "fsg-pin-names.json"
+
+var errPinNameNeedsRepo = UsageError{errors.New("-pin-name needs a -repo, pins of a temporary repo are gone on exit")}
+
+// Checks a -pin-name label, it is printed one per line by -pins.
+func ValidatePinName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return UsageError{errors.New("-pin-name can't be blank")}
+	}
+	if strings.ContainsAny(name, "\r\n") {
+		return UsageError{fmt.Errorf("-pin-name %q can't span lines", name)}
+	}
+	return nil
+}
+
+// Reads the labels of the pins in repoPath, name to CID. A repo without labels yet has an empty map.
+func LoadPinNames(repoPath string) (map[string]cid.Cid, error) {
+	names := map[string]cid.Cid{}
+	content, err := os.ReadFile(filepath.Join(repoPath, pinNamesFile))
+	if os.IsNotExist(err) {
+		return names, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cidStrs map[string]string
+	if err := json.Unmarshal(content, &cidStrs); err != nil {
+		return nil, fmt.Errorf("could not read the pin names in %s: %w", pinNamesFile, err)
+	}
+	for name, cidStr := range cidStrs {
+		c, err := cid.Parse(cidStr)
+		if err != nil {
+			return nil, fmt.Errorf("pin name %q in %s: %w", name, pinNamesFile, err)
+		}
+		names[name] = c
+	}
+	return names, nil
+}
+
+// Writes the labels back in one go, a crash can't leave half of the file behind.
+func SavePinNames(repoPath string, names map[string]cid.Cid) error {
+	cidStrs := map[string]string{}
+	for name, c := range names {
+		cidStrs[name] = c.String()
+	}
+	content, err := json.MarshalIndent(cidStrs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	namesFile := filepath.Join(repoPath, pinNamesFile)
+	tmpFile, err := os.CreateTemp(repoPath, pinNamesFile+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(append(content, '\n'))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), namesFile)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// Labels the pin of c with name. A name stands for one CID, giving it to another one fails until the old pin is
+// removed with -unpin. A CID can have several names.
+func NamePin(repoPath string, name string, c cid.Cid) error {
+	names, err := LoadPinNames(repoPath)
+	if err != nil {
+		return err
+	}
+	if named, ok := names[name]; ok {
+		if named == c {
+			return nil
+		}
+		return fmt.Errorf("%q already names %s, -unpin it first", name, named)
+	}
+	names[name] = c
+	if err := SavePinNames(repoPath, names); err != nil {
+		return fmt.Errorf("could not save the pin name: %w", err)
+	}
+	fmt.Fprintf(output.Status, "Named the pin %q\n", name)
+	return nil
+}
+
+// Points name at c, whatever it named before. For a pin that was replaced by a newer version of the same content.
+func RelabelPin(repoPath string, name string, c cid.Cid) error {
+	names, err := LoadPinNames(repoPath)
+	if err != nil {
+		return err
+	}
+	names[name] = c
+	if err := SavePinNames(repoPath, names); err != nil {
+		return fmt.Errorf("could not save the pin name: %w", err)
+	}
+	return nil
+}
+
+// Prints the recursive pins of the repo, the named ones first with their names, sorted by name, then the others.
+func ListPins(repoPath string) error {
+	if repoPath == "" {
+		return UsageError{errors.New("-pins needs a persistent repo, pass one with -repo")}
+	}
+	names, err := LoadPinNames(repoPath)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, ok, err := RunningNodeApi(repoPath)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// pins live in the repo, there is no need to go online for them
+		var node *core.IpfsNode
+		ipfsA, node, err = SpawnPersistent(ctx, repoPath, false)
+		if err != nil {
+			return fmt.Errorf("failed to spawn node: %w", err)
+		}
+		defer node.Close()
+	}
+	pins, err := ipfsA.Pin().Ls(ctx, options.Pin.Ls.Recursive())
+	if err != nil {
+		return fmt.Errorf("could not list pins: %w", err)
+	}
+	pinned := map[cid.Cid]bool{}
+	for pin := range pins {
+		if pin.Err() != nil {
+			return fmt.Errorf("could not list pins: %w", pin.Err())
+		}
+		pinned[pin.Path().RootCid()] = true
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+	named := map[cid.Cid]bool{}
+	for _, name := range sortedNames {
+		c := names[name]
+		named[c] = true
+		if pinned[c] {
+			fmt.Fprintf(output.Status, "%s  %s\n", c, name)
+		} else {
+			fmt.Fprintf(output.Status, "%s  %s (not pinned anymore)\n", c, name)
+		}
+	}
+
+	var unnamed []string
+	for c := range pinned {
+		if !named[c] {
+			unnamed = append(unnamed, c.String())
+		}
+	}
+	sort.Strings(unnamed)
+	for _, c := range unnamed {
+		fmt.Fprintln(output.Status, c)
+	}
+	return nil
+}
+
+// Removes the pin named nameOrCid, or the pin of that CID, from the repo together with all names of it. The blocks
+// stay in the repo until it is garbage collected.
+func Unpin(repoPath string, nameOrCid string) error {
+	if repoPath == "" {
+		return UsageError{errors.New("-unpin needs a persistent repo, pass one with -repo")}
+	}
+	names, err := LoadPinNames(repoPath)
+	if err != nil {
+		return err
+	}
+	c, ok := names[nameOrCid]
+	if !ok {
+		c, err = cid.Parse(GetCidStrFromString(nameOrCid))
+		if err != nil {
+			return UsageError{fmt.Errorf("%q is neither a pin name nor a CID", nameOrCid)}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, ok, err := RunningNodeApi(repoPath)
+	if err != nil {
+		return err
+	}
+	closeNode := func() error { return nil }
+	if !ok {
+		var node *core.IpfsNode
+		ipfsA, node, err = SpawnPersistent(ctx, repoPath, false)
+		if err != nil {
+			return fmt.Errorf("failed to spawn node: %w", err)
+		}
+		// closing flushes the datastore, the pin would come back otherwise
+		defer node.Close()
+		closeNode = node.Close
+	}
+
+	_, isPinned, err := ipfsA.Pin().IsPinned(ctx, path.FromCid(c), options.Pin.IsPinned.Recursive())
+	if err != nil {
+		return err
+	}
+	if isPinned {
+		if err := ipfsA.Pin().Rm(ctx, path.FromCid(c)); err != nil {
+			return fmt.Errorf("could not unpin %s: %w", c, err)
+		}
+	}
+
+	removed := 0
+	for name, named := range names {
+		if named == c {
+			delete(names, name)
+			removed += 1
+		}
+	}
+	if !isPinned && removed == 0 {
+		return fmt.Errorf("%s is not pinned", c)
+	}
+	if removed > 0 {
+		if err := SavePinNames(repoPath, names); err != nil {
+			return fmt.Errorf("could not save the pin names: %w", err)
+		}
+	}
+	fmt.Fprintf(output.Status, "Unpinned %s\n", path.FromCid(c))
+	return closeNode()
+}
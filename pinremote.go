@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pinclient "github.com/ipfs/boxo/pinning/remote/client"
+	"github.com/ipfs/go-cid"
+	serialize "github.com/ipfs/kubo/config/serialize"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Returns the endpoint and access token of a remote pinning service. service is either the endpoint URL itself, with
+// the token taken from -pin-remote-key or $FSG_PIN_REMOTE_KEY, or the name of a service configured in the -repo
+// config under Pinning.RemoteServices (like `ipfs pin remote service add` does).
+func RemotePinService(service string, repoPath string) (endpoint string, key string, err error) {
+	if strings.HasPrefix(service, "http://") || strings.HasPrefix(service, "https://") {
+		key = *flagPinRemoteKey
+		if key == "" {
+			key = os.Getenv("FSG_PIN_REMOTE_KEY")
+		}
+		if key == "" {
+			return "", "", UsageError{errors.New("missing access token for the pinning service, pass it with -pin-remote-key")}
+		}
+		return service, key, nil
+	}
+
+	if repoPath == "" {
+		return "", "", UsageError{fmt.Errorf("%q is not a URL, named pinning services need a -repo that configures them", service)}
+	}
+	cfg, err := serialize.Load(filepath.Join(repoPath, "config"))
+	if err != nil {
+		return "", "", err
+	}
+	remoteService, ok := cfg.Pinning.RemoteServices[service]
+	if !ok {
+		return "", "", UsageError{fmt.Errorf("no pinning service named %q in the repo config", service)}
+	}
+	return remoteService.API.Endpoint, remoteService.API.Key, nil
+}
+
+// Asks the remote pinning service to pin root and reports every status change until it is pinned, failed or ctx is
+// done. Our own addresses are sent along as origins so the service can fetch the blocks straight from this node.
+func PinRemote(ctx context.Context, ipfsA icore.CoreAPI, endpoint string, key string, root cid.Cid, name string) error {
+	client := pinclient.NewClient(endpoint, key)
+
+	var addOptions []pinclient.AddOption
+	if name != "" {
+		addOptions = append(addOptions, pinclient.PinOpts.WithName(name))
+	}
+	origins, err := OwnAddrs(ctx, ipfsA)
+	if err == nil && len(origins) > 0 {
+		addOptions = append(addOptions, pinclient.PinOpts.WithOrigins(origins...))
+	}
+
+	status, err := client.Add(ctx, root, addOptions...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output.Status, "\nRemote pin %s\n", status.GetStatus())
+
+	lastStatus := status.GetStatus()
+	for lastStatus != pinclient.StatusPinned && lastStatus != pinclient.StatusFailed {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+
+		status, err = client.GetStatusByID(ctx, status.GetRequestId())
+		if err != nil {
+			return err
+		}
+		if status.GetStatus() != lastStatus {
+			lastStatus = status.GetStatus()
+			fmt.Fprintf(output.Status, "\nRemote pin %s\n", lastStatus)
+		}
+	}
+
+	if lastStatus == pinclient.StatusFailed {
+		return fmt.Errorf("pinning service could not pin %s", root)
+	}
+	return nil
+}
+
+// Returns the addresses this node listens on with its peer ID appended, the form other nodes can dial directly.
+func OwnAddrs(ctx context.Context, ipfsA icore.CoreAPI) ([]ma.Multiaddr, error) {
+	self, err := ipfsA.Key().Self(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p2pPart, err := ma.NewMultiaddr("/p2p/" + self.ID().String())
+	if err != nil {
+		return nil, err
+	}
+
+	addrs, err := ipfsA.Swarm().LocalAddrs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i, addr := range addrs {
+		addrs[i] = addr.Encapsulate(p2pPart)
+	}
+	return addrs, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/kubo/plugin"
+	pluginbadgerds "github.com/ipfs/kubo/plugin/plugins/badgerds"
+	pluginiplddagjose "github.com/ipfs/kubo/plugin/plugins/dagjose"
+	pluginflatfs "github.com/ipfs/kubo/plugin/plugins/flatfs"
+	pluginfxtest "github.com/ipfs/kubo/plugin/plugins/fxtest"
+	pluginipldgit "github.com/ipfs/kubo/plugin/plugins/git"
+	pluginlevelds "github.com/ipfs/kubo/plugin/plugins/levelds"
+	pluginnopfs "github.com/ipfs/kubo/plugin/plugins/nopfs"
+	pluginpeerlog "github.com/ipfs/kubo/plugin/plugins/peerlog"
+)
+
+// The plugins kubo preloads into every plugin loader. The loader doesn't tell which plugins it has, so this mirrors
+// kubo/plugin/loader/preload.go and has to follow it when kubo is upgraded.
+var preloadedPlugins = [][]plugin.Plugin{
+	pluginipldgit.Plugins,
+	pluginiplddagjose.Plugins,
+	pluginbadgerds.Plugins,
+	pluginflatfs.Plugins,
+	pluginlevelds.Plugins,
+	pluginpeerlog.Plugins,
+	pluginfxtest.Plugins,
+	pluginnopfs.Plugins,
+}
+
+// Loads the plugins like every other run does, then prints name, version and kind of the preloaded ones and the
+// external plugin files found next to them.
+func ListPlugins() error {
+	if err := SetupPluginsOnce(); err != nil {
+		return err
+	}
+
+	for _, plugins := range preloadedPlugins {
+		for _, pl := range plugins {
+			fmt.Fprintf(output.Status, "%s %s %s\n", pl.Name(), pl.Version(), PluginKinds(pl))
+		}
+	}
+
+	// go plugins can't be inspected without loading them again, so only their files are listed. SetupPlugins hands the
+	// loader <path>/plugins as repo and the loader looks into the plugins directory of that
+	pluginDir := filepath.Join("plugins", "plugins")
+	entries, err := os.ReadDir(pluginDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			fmt.Fprintf(output.Status, "%s external plugin file in %s\n", entry.Name(), pluginDir)
+		}
+	}
+	return nil
+}
+
+// Returns what a plugin provides, e.g. "datastore badgerds" or "ipld".
+func PluginKinds(pl plugin.Plugin) string {
+	var kinds []string
+	if ds, ok := pl.(plugin.PluginDatastore); ok {
+		kinds = append(kinds, "datastore "+ds.DatastoreTypeName())
+	}
+	if _, ok := pl.(plugin.PluginIPLD); ok {
+		kinds = append(kinds, "ipld")
+	}
+	if _, ok := pl.(plugin.PluginTracer); ok {
+		kinds = append(kinds, "tracer")
+	}
+	if _, ok := pl.(plugin.PluginFx); ok {
+		kinds = append(kinds, "fx")
+	}
+	if _, ok := pl.(plugin.PluginDaemon); ok {
+		kinds = append(kinds, "daemon")
+	} else if _, ok := pl.(plugin.PluginDaemonInternal); ok {
+		kinds = append(kinds, "daemon")
+	}
+	if len(kinds) == 0 {
+		return "other"
+	}
+	return strings.Join(kinds, ", ")
+}
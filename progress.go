@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	chunk "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/kubo/core"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/schollz/progressbar/v3"
+)
+
+// How often progress is printed as a plain line when it can't be drawn in place.
+const progressLineInterval = 10 * time.Second
+
+// Whether progress can be drawn in place on the progress output (stderr). Bars and spinners redraw with control
+// characters, piped into a file or a CI log every redraw ends up as garbage.
+func ProgressEnabled() bool {
+	// the lines of -v would tear the bar apart
+	return *flagProgress && !*flagJsonProgress && !*flagVerbose && output.ProgressIsTerminal()
+}
+
+var jsonEventLock sync.Mutex
+
+// Writes a -json-progress event to stderr as a single line, e.g. {"event":"progress","done":123,"total":456}.
+// Frontends wrapping fsg read these instead of the bars meant for humans.
+func EmitEvent(event string, fields map[string]any) {
+	line := map[string]any{"event": event}
+	if transferId != "" {
+		line["id"] = transferId
+	}
+	for key, value := range fields {
+		line[key] = value
+	}
+	jsonEventLock.Lock()
+	defer jsonEventLock.Unlock()
+	json.NewEncoder(output.Progress).Encode(line)
+}
+
+// Emits a "peer" event with the number of connected peers whenever it changes, until ctx is done.
+func EmitPeerEvents(ctx context.Context, ipfsA icore.CoreAPI) {
+	lastCount := -1
+	for {
+		peers, err := ipfsA.Swarm().Peers(ctx)
+		if err == nil && len(peers) != lastCount {
+			lastCount = len(peers)
+			EmitEvent("peer", map[string]any{"count": lastCount})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// Whether progress is counted in blocks instead of bytes, see -progress-unit.
+func ProgressInBlocks() (bool, error) {
+	switch *flagProgressUnit {
+	case "bytes":
+		return false, nil
+	case "blocks":
+		return true, nil
+	}
+	return false, UsageError{fmt.Errorf("unknown -progress-unit %q, use bytes or blocks", *flagProgressUnit)}
+}
+
+// Shows how far a download or an add got until ctx is done: as a bar, as "progress" events with -json-progress or as
+// a line every progressLineInterval when the bar is disabled. current returns the bytes done so far, or the blocks
+// with -progress-unit blocks. A negative total means it isn't known. description is shown next to the bar (e.g.
+// "downloading") and verb starts the lines (e.g. "Downloaded").
+func ShowProgress(ctx context.Context, description string, verb string, current func() int64, total int64, inBlocks bool) {
+
+	if *flagJsonProgress {
+		lastDone := int64(-1)
+		for {
+			// the last event has to show the final count, so check once more after ctx is done
+			finished := ctx.Err() != nil
+			if done := current(); done != lastDone {
+				lastDone = done
+				fields := map[string]any{"done": done}
+				if total >= 0 {
+					fields["total"] = total
+				}
+				if inBlocks {
+					fields["unit"] = "blocks"
+				}
+				EmitEvent("progress", fields)
+			}
+			if finished {
+				return
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+	}
+
+	if ProgressEnabled() {
+		var bar *progressbar.ProgressBar
+		if inBlocks {
+			bar = output.NewProgressBar(total, description, true)
+		} else {
+			bar = output.NewProgressBar(total, description, false)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				bar.Set64(current())
+				bar.Finish()
+				return
+			case <-time.After(100 * time.Millisecond):
+			}
+			bar.Set64(current())
+		}
+	}
+
+	lastDone := int64(-1)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(progressLineInterval):
+		}
+		done := current()
+		if done == lastDone {
+			continue
+		}
+		lastDone = done
+		switch {
+		case inBlocks && total >= 0:
+			fmt.Fprintf(output.Status, "%s %d of %d blocks\n", verb, done, total)
+		case inBlocks:
+			fmt.Fprintf(output.Status, "%s %d blocks\n", verb, done)
+		default:
+			// directory sizes include the DAG overhead, so the written bytes never quite reach them
+			percent := int64(100)
+			if total > 0 && done < total {
+				percent = done * 100 / total
+			}
+			fmt.Fprintf(output.Status, "%s %d%% (%s of %s)\n", verb, percent, FormatSize(uint64(done)), FormatSize(uint64(total)))
+		}
+	}
+}
+
+// Counts what a running add got through from its progress events: the bytes hashed and the data blocks they were
+// split into. Safe to read while the add runs.
+type AddProgress struct {
+	chunkSize int64
+	hashed    atomic.Int64
+	blocks    atomic.Int64
+	// files and directories the add finished
+	added atomic.Int64
+}
+
+// Returns an AddProgress for the current -chunker. Blocks can only be counted for fixed size chunks, the
+// content-defined chunkers decide block boundaries by the data.
+func NewAddProgress() *AddProgress {
+	chunkSize := int64(chunk.DefaultBlockSize)
+	if *flagChunker != "" {
+		size, err := strconv.ParseInt(strings.TrimPrefix(*flagChunker, "size-"), 10, 64)
+		if err != nil || !strings.HasPrefix(*flagChunker, "size-") || size <= 0 {
+			chunkSize = 0
+		} else {
+			chunkSize = size
+		}
+	}
+	return &AddProgress{chunkSize: chunkSize}
+}
+
+// Counts the progress events of an add until events is closed. With -v every file is printed when the add starts
+// hashing it and again with its CID once it is added.
+func (p *AddProgress) Track(events <-chan interface{}) {
+	// Bytes grows per file, only the difference to the previous event of the same file is new
+	lastBytes := map[string]int64{}
+	for event := range events {
+		addEvent, ok := event.(*icore.AddEvent)
+		if !ok {
+			continue
+		}
+		if addEvent.Path.RootCid().Defined() {
+			p.added.Add(1)
+			if *flagVerbose {
+				PrintAdded(addEvent)
+			}
+			continue
+		}
+		if addEvent.Bytes == 0 {
+			continue
+		}
+		if _, started := lastBytes[addEvent.Name]; !started && *flagVerbose {
+			fmt.Fprintf(output.Status, "Hashing %s\n", addEvent.Name)
+		}
+		p.hashed.Add(addEvent.Bytes - lastBytes[addEvent.Name])
+		if p.chunkSize > 0 {
+			p.blocks.Add(p.chunks(addEvent.Bytes) - p.chunks(lastBytes[addEvent.Name]))
+		}
+		lastBytes[addEvent.Name] = addEvent.Bytes
+	}
+}
+
+// Prints a file or directory the add finished, with its CID and size.
+func PrintAdded(addEvent *icore.AddEvent) {
+	name := addEvent.Name
+	if name == "" {
+		name = "(root)"
+	}
+	size, err := strconv.ParseUint(addEvent.Size, 10, 64)
+	if err != nil {
+		fmt.Fprintf(output.Status, "Added %s %s\n", addEvent.Path.RootCid(), name)
+		return
+	}
+	fmt.Fprintf(output.Status, "Added %s %s (%s)\n", addEvent.Path.RootCid(), name, FormatSize(size))
+}
+
+// With -v tells when the add sent no per-file events, some APIs (an older node behind -api) don't, then only the
+// root CID is known.
+func (p *AddProgress) NoteMissingEvents() {
+	if *flagVerbose && p.added.Load() == 0 {
+		fmt.Fprintln(output.Status, "The add reported no files, only its root CID is known")
+	}
+}
+
+func (p *AddProgress) chunks(bytes int64) int64 {
+	return (bytes + p.chunkSize - 1) / p.chunkSize
+}
+
+// Bytes hashed so far.
+func (p *AddProgress) Hashed() int64 {
+	return p.hashed.Load()
+}
+
+// Data blocks the hashed bytes were split into so far.
+func (p *AddProgress) Blocks() int64 {
+	return p.blocks.Load()
+}
+
+// Whether Blocks can count the blocks of the current -chunker.
+func (p *AddProgress) CountsBlocks() bool {
+	return p.chunkSize > 0
+}
+
+// Returns a counter of the blocks node received from peers since the call, for -progress-unit blocks on downloads.
+func BlocksReceived(node *core.IpfsNode) func() int64 {
+	return bitswapCounter(node, func(stat *bitswap.Stat) int64 { return int64(stat.BlocksReceived) })
+}
+
+// Returns a counter of the block bytes node received from peers since the call, duplicates included.
+func BytesReceived(node *core.IpfsNode) func() int64 {
+	return bitswapCounter(node, func(stat *bitswap.Stat) int64 { return int64(stat.DataReceived) })
+}
+
+func bitswapCounter(node *core.IpfsNode, count func(stat *bitswap.Stat) int64) func() int64 {
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return func() int64 { return 0 }
+	}
+	received := func() int64 {
+		stat, err := bs.Stat()
+		if err != nil {
+			return 0
+		}
+		return count(stat)
+	}
+	before := received()
+	return func() int64 {
+		return received() - before
+	}
+}
+
+// Runs ShowProgress in the background, the returned func stops it and waits until the bar is gone.
+func StartProgress(ctx context.Context, description string, verb string, current func() int64, total int64, inBlocks bool) func() {
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	go func() {
+		ShowProgress(progressCtx, description, verb, current, total, inBlocks)
+		close(progressDone)
+	}()
+	return func() {
+		cancelProgress()
+		<-progressDone
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Tracks how many blocks of an added DAG were announced to the DHT so far. Safe to read while providing runs.
+type ProvideProgress struct {
+	done     atomic.Int64
+	failed   atomic.Int64
+	total    atomic.Int64
+	finished atomic.Bool
+}
+
+func (p *ProvideProgress) String() string {
+	if p.total.Load() == 0 {
+		return "collecting blocks to provide"
+	}
+	if p.finished.Load() {
+		return fmt.Sprintf("provided %d/%d blocks (%d failed)", p.done.Load(), p.total.Load(), p.failed.Load())
+	}
+	return fmt.Sprintf("providing %d/%d blocks", p.done.Load(), p.total.Load())
+}
+
+// Announces every block under root to the DHT one by one so progress can be reported. It is meant to run in the
+// background after the add finished, the CID is already usable by others while this is still going.
+func ProvideDag(ctx context.Context, ipfsA icore.CoreAPI, root cid.Cid, progress *ProvideProgress) error {
+	defer progress.finished.Store(true)
+
+	blocks, err := CollectDagCids(ctx, ipfsA, root)
+	if err != nil {
+		return err
+	}
+	progress.total.Store(int64(len(blocks)))
+
+	for _, c := range blocks {
+		err = ipfsA.Dht().Provide(ctx, path.FromCid(c), options.Dht.Recursive(false))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			progress.failed.Add(1)
+		}
+		progress.done.Add(1)
+	}
+	return nil
+}
+
+// Returns the CIDs of all blocks reachable from root, root included, each one only once.
+func CollectDagCids(ctx context.Context, ipfsA icore.CoreAPI, root cid.Cid) ([]cid.Cid, error) {
+	var cids []cid.Cid
+	err := WalkDag(ctx, ipfsA, root, func(nd ipld.Node) error {
+		cids = append(cids, nd.Cid())
+		return nil
+	})
+	return cids, err
+}
+
+// Calls visit for every block reachable from root, root first, each one only once even when several links point to
+// it. Stops at the first error.
+func WalkDag(ctx context.Context, ipfsA icore.CoreAPI, root cid.Cid, visit func(nd ipld.Node) error) error {
+	seen := map[cid.Cid]bool{root: true}
+	queue := []cid.Cid{root}
+
+	for i := 0; i < len(queue); i++ {
+		nd, err := ipfsA.Dag().Get(ctx, queue[i])
+		if err != nil {
+			return err
+		}
+		if err := visit(nd); err != nil {
+			return err
+		}
+		for _, link := range nd.Links() {
+			if !seen[link.Cid] {
+				seen[link.Cid] = true
+				queue = append(queue, link.Cid)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ipfs/boxo/path"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Points the IPNS name of -publish-key at root and prints the /ipns/ path to share. The name stays the same between
+// runs only with a -repo or -identity-seed, a temporary repo has a new self key every time.
+func PublishName(ctx context.Context, ipfsA icore.CoreAPI, root path.Path) error {
+	name, err := ipfsA.Name().Publish(ctx, root, options.Name.Key(*flagPublishKey), options.Name.AllowOffline(true))
+	if err != nil {
+		return fmt.Errorf("could not publish %s under the key %q: %w", root, *flagPublishKey, err)
+	}
+	fmt.Fprintf(output.Status, "\nPublished %s at %s\n", root, name.AsPath())
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Parses the -rename values into output names by entry path. Sources are slash separated paths below the downloaded
+// CID, a top level entry is just its name. Targets replace the name within the same directory, a target with slashes
+// nests the entry into directories that are created for it.
+func ParseRenames(values []string) (map[string]string, error) {
+	renames := map[string]string{}
+	targets := map[string]string{}
+	for _, value := range values {
+		source, target, ok := strings.Cut(value, "=")
+		if !ok {
+			return nil, fmt.Errorf("-rename %q is not of the form old=new", value)
+		}
+		source = strings.Trim(source, "/")
+		if !ValidEntryPath(source) {
+			return nil, fmt.Errorf("-rename %q: %q is not a path below the CID", value, source)
+		}
+		if !ValidEntryPath(target) {
+			return nil, fmt.Errorf("-rename %q: %q is not a valid name, it must stay inside its directory", value, target)
+		}
+		if _, ok := renames[source]; ok {
+			return nil, fmt.Errorf("-rename %q: %s is renamed twice", value, source)
+		}
+
+		// the written path, two sources in the same directory can't end up there both
+		written := path.Join(path.Dir(source), target)
+		if other, ok := targets[written]; ok {
+			return nil, fmt.Errorf("-rename %q: %s and %s would both be written to %s", value, other, source, written)
+		}
+		renames[source] = target
+		targets[written] = source
+	}
+	return renames, nil
+}
+
+// Whether p is a relative slash separated path of valid entry names, see ValidEntryName.
+func ValidEntryPath(p string) bool {
+	for _, name := range strings.Split(p, "/") {
+		if !ValidEntryName(name) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the path below the CID of the entry name inside the directory at dir ("" is the CID itself).
+func EntrySource(dir string, name string) string {
+	return path.Join(dir, name)
+}
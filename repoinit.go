@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	serialize "github.com/ipfs/kubo/config/serialize"
+	"github.com/ipfs/kubo/repo/fsrepo"
+	"github.com/ipfs/kubo/repo/fsrepo/migrations"
+)
+
+// The files fsrepo.Init writes, in this order. Blocks and keys are only written once the repo is opened, which needs
+// all three, so a repo missing some of them holds nothing that could be lost.
+var repoInitFiles = []string{"config", "datastore_spec", "version"}
+
+// Returns which of repoInitFiles are missing or unreadable at repoPath, and whether the repo is partially initialized:
+// some of them exist but not all, as left behind by an init that was interrupted or failed partway.
+func MissingRepoFiles(repoPath string) (missing []string, partial bool) {
+	for _, name := range repoInitFiles {
+		filePath := filepath.Join(repoPath, name)
+		if _, err := os.Stat(filePath); err != nil {
+			missing = append(missing, name)
+			continue
+		}
+		partial = true
+		if name == "config" {
+			// a config cut short while it was written exists, fsrepo.Open still can't read it
+			if _, err := serialize.Load(filePath); err != nil {
+				missing = append(missing, name)
+			}
+		}
+	}
+	return missing, partial && len(missing) > 0
+}
+
+// Initializes a new repo at repoPath like InitRepo, but in a temporary sibling directory that is renamed to repoPath
+// once the init is done. An init that is interrupted leaves the sibling behind instead of a repo fsrepo.Open refuses,
+// the next one removes it. A repoPath with other files in it can't be replaced and is initialized in place.
+func InitRepoAtomic(repoPath string) error {
+	repoPath = filepath.Clean(repoPath)
+	parent, base := filepath.Split(repoPath)
+	if parent == "" {
+		parent = "."
+	}
+	if err := os.MkdirAll(parent, 0o700); err != nil {
+		return fmt.Errorf("failed to create repo dir: %w", err)
+	}
+
+	// only an empty directory is replaced, a non-empty one is left alone and anything else isn't a repo
+	info, err := os.Lstat(repoPath)
+	if err == nil {
+		if !info.IsDir() {
+			return fmt.Errorf("can't create a repo at %s, it exists and is not a directory", repoPath)
+		}
+		entries, err := os.ReadDir(repoPath)
+		if err != nil {
+			return fmt.Errorf("failed to read repo dir: %w", err)
+		}
+		if len(entries) > 0 {
+			return InitRepo(repoPath)
+		}
+		if err := os.Remove(repoPath); err != nil {
+			return fmt.Errorf("failed to create repo dir: %w", err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to create repo dir: %w", err)
+	}
+
+	pattern := "." + base + ".init-"
+	leftovers, _ := filepath.Glob(filepath.Join(parent, pattern+"*"))
+	for _, leftover := range leftovers {
+		fmt.Fprintf(output.Status, "Removing %s left behind by an interrupted repo init\n", leftover)
+		os.RemoveAll(leftover)
+	}
+
+	tmpPath, err := os.MkdirTemp(parent, pattern)
+	if err != nil {
+		return fmt.Errorf("failed to create repo dir: %w", err)
+	}
+	if err := InitRepo(tmpPath); err != nil {
+		os.RemoveAll(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, repoPath); err != nil {
+		os.RemoveAll(tmpPath)
+		return fmt.Errorf("could not move the new repo to %s: %w", repoPath, err)
+	}
+	return nil
+}
+
+// Writes the repoInitFiles missing at the partially initialized repo at repoPath and keeps everything that is there.
+// A config that can't be read is moved to config.broken and a new one with a new identity (or the one from
+// -identity-seed) takes its place, the peer ID changes then.
+func RepairRepo(repoPath string) error {
+	missing, partial := MissingRepoFiles(repoPath)
+	if !partial {
+		if len(missing) == 0 {
+			fmt.Fprintf(output.Status, "The repo at %s is complete, nothing to repair\n", repoPath)
+		}
+		return nil
+	}
+	fmt.Fprintf(output.Status, "Repairing the repo at %s, missing %s\n", repoPath, strings.Join(missing, ", "))
+
+	configPath := filepath.Join(repoPath, "config")
+	cfg, err := serialize.Load(configPath)
+	if err != nil {
+		if _, err := os.Stat(configPath); err == nil {
+			if err := os.Rename(configPath, configPath+".broken"); err != nil {
+				return fmt.Errorf("could not move the unreadable config aside: %w", err)
+			}
+			fmt.Fprintf(output.Status, "Moved the unreadable config to %s.broken\n", configPath)
+		}
+		cfg, err = NewConfig()
+		if err != nil {
+			return err
+		}
+		if err := serialize.WriteConfigFile(configPath, cfg); err != nil {
+			return fmt.Errorf("could not write a new config: %w", err)
+		}
+		fmt.Fprintf(output.Status, "Wrote a new config, the node has the peer ID %s\n", cfg.Identity.PeerID)
+	}
+
+	specPath := filepath.Join(repoPath, "datastore_spec")
+	if _, err := os.Stat(specPath); err != nil {
+		dsc, err := fsrepo.AnyDatastoreConfig(cfg.Datastore.Spec)
+		if err != nil {
+			return fmt.Errorf("the datastore of the config is invalid: %w", err)
+		}
+		if err := os.WriteFile(specPath, dsc.DiskSpec().Bytes(), 0o600); err != nil {
+			return fmt.Errorf("could not write the datastore spec: %w", err)
+		}
+		fmt.Fprintln(output.Status, "Wrote the datastore spec from the config")
+	}
+
+	if _, err := os.Stat(filepath.Join(repoPath, "version")); err != nil {
+		// written last by the init, nothing was stored in an older repo format before it
+		if err := migrations.WriteRepoVersion(repoPath, fsrepo.RepoVersion); err != nil {
+			return fmt.Errorf("could not write the repo version: %w", err)
+		}
+		fmt.Fprintf(output.Status, "Wrote the repo version %d\n", fsrepo.RepoVersion)
+	}
+	return nil
+}
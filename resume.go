@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	bstore "github.com/ipfs/boxo/blockstore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+)
+
+// Wraps the blockstore of a persistent repo for an add and counts which blocks the repo already had. The add checks
+// Has for every block before it writes it and skips the ones that are there, so re-running an interrupted add of the
+// same files only writes what is still missing. The files are still read and hashed, that is the only way to learn
+// their CIDs.
+type ResumeBlockstore struct {
+	bstore.Blockstore
+	present atomic.Int64
+	stored  atomic.Int64
+}
+
+func (b *ResumeBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	has, err := b.Blockstore.Has(ctx, c)
+	if err == nil && has {
+		b.present.Add(1)
+	}
+	return has, err
+}
+
+func (b *ResumeBlockstore) Put(ctx context.Context, block blocks.Block) error {
+	if err := b.Blockstore.Put(ctx, block); err != nil {
+		return err
+	}
+	b.stored.Add(1)
+	return nil
+}
+
+func (b *ResumeBlockstore) PutMany(ctx context.Context, blks []blocks.Block) error {
+	if err := b.Blockstore.PutMany(ctx, blks); err != nil {
+		return err
+	}
+	b.stored.Add(int64(len(blks)))
+	return nil
+}
+
+// Returns the share of the blocks added so far that were already in the repo, 0 when nothing was added yet.
+func (b *ResumeBlockstore) AlreadyPercent() int {
+	present, stored := b.present.Load(), b.stored.Load()
+	if present == 0 {
+		return 0
+	}
+	return int(present * 100 / (present + stored))
+}
+
+// Prints "Resuming, N% already in repo" every couple of seconds while content that is already there is being added,
+// until ctx is done.
+func ReportResume(ctx context.Context, b *ResumeBlockstore) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(2 * time.Second):
+		}
+		if percent := b.AlreadyPercent(); percent > 0 {
+			fmt.Fprintf(output.Status, "Resuming, %d%% already in repo\n", percent)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/boxo/datastore/dshelp"
+	"github.com/ipfs/boxo/keystore"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/mount"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/ipfs/kubo/repo"
+	car "github.com/ipld/go-car/v2"
+	carblockstore "github.com/ipld/go-car/v2/blockstore"
+)
+
+// Reads through the CAR file at carPath, which checks every block against its CID, and returns the roots named in
+// its header and how many blocks it holds.
+func ValidateCar(carPath string) ([]cid.Cid, int, error) {
+	f, err := os.Open(carPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	reader, err := car.NewBlockReader(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("not a valid CAR file: %w", err)
+	}
+	if len(reader.Roots) == 0 {
+		return nil, 0, errors.New("CAR file has no roots")
+	}
+
+	blockCount := 0
+	for {
+		_, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, blockCount, fmt.Errorf("block %d: %w", blockCount+1, err)
+		}
+		blockCount += 1
+	}
+	return reader.Roots, blockCount, nil
+}
+
+// Spawns an online node whose repo lives in memory, except for the blocks: those are read from the CAR file at
+// carPath, which is never written to.
+func SpawnFromCar(ctx context.Context, carPath string) (icore.CoreAPI, *core.IpfsNode, error) {
+	if err := SetupPluginsOnce(); err != nil {
+		return nil, nil, err
+	}
+
+	cfg, err := NewConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	blocks, err := carblockstore.OpenReadOnly(carPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open %s: %w", carPath, err)
+	}
+
+	memory := dssync.MutexWrap(datastore.NewMapDatastore())
+	node, err := core.NewNode(ctx, &core.BuildCfg{
+		Online:  true,
+		Routing: NodeRouting(),
+		Repo: &repo.Mock{
+			C: *cfg,
+			D: mount.New([]mount.Mount{
+				{Prefix: datastore.NewKey("/blocks"), Datastore: &carDatastore{car: blocks, overlay: dssync.MutexWrap(datastore.NewMapDatastore())}},
+				{Prefix: datastore.NewKey("/"), Datastore: memory},
+			}),
+			K: keystore.NewMemKeystore(),
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	api, err := coreapi.NewCoreAPI(node)
+	return api, node, err
+}
+
+// Seeds the blocks of the CAR file at carPath without importing them anywhere, until interrupted. Every root of the
+// file is announced and printed, roots whose DAG the file doesn't fully hold are marked as incomplete.
+func SeedCarFile(carPath string) error {
+	if *flagRepo != "" {
+		return UsageError{errors.New("-seed-car serves the blocks from the file, it doesn't use a -repo")}
+	}
+
+	roots, blockCount, err := ValidateCar(carPath)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", carPath, err)
+	}
+
+	ctx, ipfsA, node, cancel, err := StartIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	offlineApi, err := ipfsA.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(output.Status, "Seeding %d blocks from %s\n", blockCount, carPath)
+	fmt.Fprintln(output.Status, "Root CID(s):")
+	for _, root := range roots {
+		if _, err := CollectDagCids(ctx, offlineApi, root); err != nil {
+			fmt.Fprintf(output.Status, "%s (incomplete: %s)\n", path.FromCid(root), err)
+		} else {
+			fmt.Fprintln(output.Status, path.FromCid(root).String())
+		}
+	}
+
+	if routingOff, _ := ContentRoutingOff(); !routingOff {
+		go func() {
+			for _, root := range roots {
+				err := ProvideDag(ctx, ipfsA, root, &ProvideProgress{})
+				if err != nil && ctx.Err() == nil {
+					fmt.Fprintf(output.Status, "\nerror providing blocks of %s: %s\n", root, err)
+				}
+			}
+		}()
+	}
+
+	SeedUntilStopped(ctx, node, nil)
+	fmt.Fprintln(output.Status, "Adios!")
+	return nil
+}
+
+// Serves the blocks of a CAR file under the datastore keys the blockstore uses, to be mounted at /blocks. The file
+// is only read, whatever the node writes there is kept in overlay.
+type carDatastore struct {
+	car     *carblockstore.ReadOnly
+	overlay datastore.Batching
+}
+
+// Blockstore keys only hold the multihash, the CAR blockstore looks blocks up by multihash too.
+func carKeyCid(key datastore.Key) (cid.Cid, error) {
+	mh, err := dshelp.DsKeyToMultihash(key)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(cid.Raw, mh), nil
+}
+
+func (d *carDatastore) Get(ctx context.Context, key datastore.Key) ([]byte, error) {
+	value, err := d.overlay.Get(ctx, key)
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return value, err
+	}
+	c, err := carKeyCid(key)
+	if err != nil {
+		return nil, datastore.ErrNotFound
+	}
+	block, err := d.car.Get(ctx, c)
+	if ipld.IsNotFound(err) {
+		return nil, datastore.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return block.RawData(), nil
+}
+
+func (d *carDatastore) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	if has, err := d.overlay.Has(ctx, key); has || err != nil {
+		return has, err
+	}
+	c, err := carKeyCid(key)
+	if err != nil {
+		return false, nil
+	}
+	return d.car.Has(ctx, c)
+}
+
+func (d *carDatastore) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	size, err := d.overlay.GetSize(ctx, key)
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return size, err
+	}
+	c, err := carKeyCid(key)
+	if err != nil {
+		return -1, datastore.ErrNotFound
+	}
+	size, err = d.car.GetSize(ctx, c)
+	if ipld.IsNotFound(err) {
+		return -1, datastore.ErrNotFound
+	}
+	return size, err
+}
+
+func (d *carDatastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	return d.overlay.Put(ctx, key, value)
+}
+
+// Blocks of the file can't be deleted, only the ones in overlay.
+func (d *carDatastore) Delete(ctx context.Context, key datastore.Key) error {
+	return d.overlay.Delete(ctx, key)
+}
+
+func (d *carDatastore) Sync(ctx context.Context, prefix datastore.Key) error {
+	return d.overlay.Sync(ctx, prefix)
+}
+
+func (d *carDatastore) Close() error {
+	return errors.Join(d.overlay.Close(), d.car.Close())
+}
+
+func (d *carDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	return datastore.NewBasicBatch(d), nil
+}
+
+// Lists the blocks of the file and of overlay, reprovide and GC go through all keys this way.
+func (d *carDatastore) Query(ctx context.Context, q query.Query) (query.Results, error) {
+	overlayResults, err := d.overlay.Query(ctx, query.Query{KeysOnly: q.KeysOnly})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := overlayResults.Rest()
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := d.car.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for c := range keys {
+		entry := query.Entry{Key: dshelp.MultihashToDsKey(c.Hash()).String()}
+		if !q.KeysOnly {
+			block, err := d.car.Get(ctx, c)
+			if err != nil {
+				return nil, err
+			}
+			entry.Value = block.RawData()
+			entry.Size = len(entry.Value)
+		}
+		entries = append(entries, entry)
+	}
+	return query.NaiveQueryApply(q, query.ResultsWithEntries(q, entries)), nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+var errSeedFileNeedsRepo = UsageError{errors.New("-seed-file needs a -repo, a temporary repo forgets the content on exit")}
+
+// Reads the CIDs listed in a -seed-file, one per line. Blank lines and lines starting with # are skipped, a CID
+// listed twice is returned once. A file that doesn't exist yet is an empty list.
+func LoadSeedFile(seedFile string) ([]cid.Cid, error) {
+	f, err := os.Open(seedFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cids []cid.Cid
+	seen := map[cid.Cid]bool{}
+	scanner := bufio.NewScanner(f)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		c, err := cid.Parse(GetCidStrFromString(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", seedFile, lineNumber, err)
+		}
+		if !seen[c] {
+			seen[c] = true
+			cids = append(cids, c)
+		}
+	}
+	return cids, scanner.Err()
+}
+
+// Appends c to the -seed-file unless it is listed already, returns whether it was added.
+func AddToSeedFile(seedFile string, c cid.Cid) (bool, error) {
+	cids, err := LoadSeedFile(seedFile)
+	if err != nil {
+		return false, err
+	}
+	for _, listed := range cids {
+		if listed == c {
+			return false, nil
+		}
+	}
+
+	f, err := os.OpenFile(seedFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return false, err
+	}
+	_, err = fmt.Fprintln(f, path.FromCid(c))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err == nil, err
+}
+
+// Removes every line listing c from the -seed-file and keeps the rest as it is, returns whether c was listed. The
+// file is replaced in one go, a crash can't leave half of it behind.
+func RemoveFromSeedFile(seedFile string, c cid.Cid) (bool, error) {
+	info, err := os.Stat(seedFile)
+	if err != nil {
+		return false, err
+	}
+	content, err := os.ReadFile(seedFile)
+	if err != nil {
+		return false, err
+	}
+
+	var kept []string
+	removed := false
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		listed, err := cid.Parse(GetCidStrFromString(strings.TrimSpace(line)))
+		if err == nil && listed == c {
+			removed = true
+			continue
+		}
+		kept = append(kept, line)
+	}
+	if !removed {
+		return false, nil
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(seedFile), filepath.Base(seedFile)+".*")
+	if err != nil {
+		return false, err
+	}
+	// CreateTemp makes the file 0600, the replacement keeps the permissions the seed file had
+	err = tmpFile.Chmod(info.Mode().Perm())
+	if err == nil {
+		_, err = tmpFile.WriteString(strings.Join(kept, ""))
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), seedFile)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return false, err
+	}
+	return true, nil
+}
+
+// Announces the DAGs of cids in the background, one after the other, skipping skip (the CID just uploaded, which is
+// announced on its own). Content missing from the repo is reported and left out.
+func ProvideSeedList(ctx context.Context, ipfsA icore.CoreAPI, cids []cid.Cid, skip cid.Cid) {
+	if routingOff, _ := ContentRoutingOff(); routingOff {
+		return
+	}
+	offlineApi, err := ipfsA.WithOptions(options.Api.Offline(true))
+	if err != nil {
+		fmt.Fprintf(output.Status, "could not check the -seed-file content: %s\n", err)
+		return
+	}
+	go func() {
+		for _, c := range cids {
+			if c == skip {
+				continue
+			}
+			// only what is in the repo can be served, fetching missing blocks isn't the seeder's job
+			if _, err := CollectDagCids(ctx, offlineApi, c); err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(output.Status, "\n%s from the -seed-file is not complete in the repo: %s\n", c, err)
+				}
+				continue
+			}
+			err := ProvideDag(ctx, ipfsA, c, &ProvideProgress{})
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nerror providing blocks of %s: %s\n", c, err)
+			}
+		}
+	}()
+}
+
+// Serves everything listed in the -seed-file from the -repo until stopped, re-announcing it first. This is what a
+// restarted seeder runs to pick up where it left off.
+func SeedFromFile(seedFile string) error {
+	if *flagRepo == "" {
+		return errSeedFileNeedsRepo
+	}
+	cids, err := LoadSeedFile(seedFile)
+	if err != nil {
+		return err
+	}
+	if len(cids) == 0 {
+		return UsageError{fmt.Errorf("%s lists no CIDs to seed, add some with -f", seedFile)}
+	}
+
+	ctx, ipfsA, node, cancel, err := StartIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	fmt.Fprintf(output.Status, "Seeding %d CID(s) from %s:\n", len(cids), seedFile)
+	for _, c := range cids {
+		fmt.Fprintln(output.Status, path.FromCid(c).String())
+	}
+	ProvideSeedList(ctx, ipfsA, cids, cid.Undef)
+
+	SeedUntilStopped(ctx, node, nil)
+	fmt.Fprintln(output.Status, "Adios!")
+	return nil
+}
+
+// Takes c off the -seed-file, a later SeedFromFile no longer announces it. The content stays pinned in the repo.
+func UnseedCid(seedFile string, cidStr string) error {
+	c, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+	removed, err := RemoveFromSeedFile(seedFile, c)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return fmt.Errorf("%s is not listed in %s", c, seedFile)
+	}
+	fmt.Fprintf(output.Status, "Removed %s from %s\n", c, seedFile)
+	return nil
+}
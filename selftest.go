@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/kubo/core/coreapi"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// Goes through the same stages as a normal run on a throwaway repo and prints PASS/FAIL for each of them, so a broken
+// setup shows where it breaks. Returns false if any stage failed.
+func SelfTest() bool {
+	content := []byte("fsg selftest\n")
+
+	if !ReportStage("load plugins", SetupPluginsOnce()) {
+		return false
+	}
+
+	repoPath, err := CreateTempRepo()
+	if !ReportStage("init temporary repo", err) {
+		return false
+	}
+	defer func() {
+		ReportStage("remove temporary repo", os.RemoveAll(repoPath))
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	node, err := CreateNode(ctx, repoPath, true)
+	if !ReportStage("spawn node", err) {
+		return false
+	}
+	defer func() {
+		ReportStage("stop node", node.Close())
+	}()
+
+	ipfsA, err := coreapi.NewCoreAPI(node)
+	if !ReportStage("create core API", err) {
+		return false
+	}
+
+	added, err := ipfsA.Unixfs().Add(ctx, files.NewBytesFile(content))
+	if !ReportStage("add file", err) {
+		return false
+	}
+
+	var readBack []byte
+	rootNode, err := ipfsA.Unixfs().Get(ctx, added)
+	if err == nil {
+		if file, ok := rootNode.(files.File); ok {
+			readBack, err = io.ReadAll(file)
+		} else {
+			err = fmt.Errorf("got a %T instead of a file", rootNode)
+		}
+	}
+	if err == nil && !bytes.Equal(readBack, content) {
+		err = fmt.Errorf("read %q, expected %q", readBack, content)
+	}
+	if !ReportStage("read file back", err) {
+		return false
+	}
+
+	// the bytes we got back must hash to the very same CID
+	rehashed, err := ipfsA.Unixfs().Add(ctx, files.NewBytesFile(readBack), options.Unixfs.HashOnly(true))
+	if err == nil && rehashed.RootCid() != added.RootCid() {
+		err = fmt.Errorf("got %s, expected %s", rehashed.RootCid(), added.RootCid())
+	}
+	return ReportStage("CID matches", err)
+}
+
+// Prints the outcome of a self test stage and returns whether it passed.
+func ReportStage(stage string, err error) bool {
+	if err != nil {
+		fmt.Fprintf(output.Status, "FAIL %s: %s\n", stage, err)
+		return false
+	}
+	fmt.Fprintf(output.Status, "PASS %s\n", stage)
+	return true
+}
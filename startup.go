@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	icore "github.com/ipfs/kubo/core/coreiface"
+)
+
+// The stages StartIpfsNode goes through: repo, node, listen, bootstrap and first peer.
+const startupStages = 5
+
+// Prints which stage of the startup is running, as "[2/5] Spawning Kubo node" or as a "stage" event with
+// -json-progress, so a slow start shows where it is stuck.
+func StartupStage(n int, text string) {
+	if *flagJsonProgress {
+		EmitEvent("stage", map[string]any{"stage": n, "of": startupStages, "text": text})
+		return
+	}
+	fmt.Fprintf(output.Status, "[%d/%d] %s\n", n, startupStages, text)
+}
+
+// Waits until the node is connected to a peer and prints how long that took since started. It runs next to the
+// upload or download, which don't need a peer to begin with.
+func ReportFirstPeer(ctx context.Context, ipfsA icore.CoreAPI, started time.Time) {
+	for {
+		peers, err := ipfsA.Swarm().Peers(ctx)
+		if err == nil && len(peers) > 0 {
+			if *flagJsonProgress {
+				EmitEvent("stage", map[string]any{"stage": startupStages, "of": startupStages, "text": "connected", "seconds": time.Since(started).Seconds()})
+			} else {
+				fmt.Fprintf(output.Status, "Connected to the first peer after %s\n", time.Since(started).Round(100*time.Millisecond))
+			}
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+)
+
+// With -strict checks the download inputs before any node is started, see CheckStrictInput.
+func CheckStrictInputs(inputs ...string) error {
+	if !*flagStrict {
+		return nil
+	}
+	for _, input := range inputs {
+		if err := CheckStrictInput(input); err != nil {
+			return UsageError{err}
+		}
+	}
+	return nil
+}
+
+// Checks a download input for -strict: a CID or an /ipfs/<cid> or /ipns/<name> path exactly as given, nothing else.
+// Without -strict GetCidStrFromString takes the last path segment and trims whitespace, which turns a mangled link
+// into some other CID rather than an error. The only extras allowed are the ?expires= and ?peer= hints of a share link.
+func CheckStrictInput(input string) error {
+	link, query, hasQuery := strings.Cut(input, "?")
+	if hasQuery {
+		if err := checkStrictHints(input, query); err != nil {
+			return err
+		}
+	}
+
+	if !strings.HasPrefix(link, "/") {
+		if _, err := cid.Decode(link); err != nil {
+			return fmt.Errorf("-strict: %q is not a valid CID: %w", link, err)
+		}
+		return nil
+	}
+
+	p, err := path.NewPath(link)
+	if err != nil {
+		return fmt.Errorf("-strict: %q is not a valid /ipfs/ or /ipns/ path: %w", link, err)
+	}
+	segments := p.Segments()
+	switch p.Namespace() {
+	case path.IPFSNamespace:
+		if _, err := cid.Decode(segments[1]); err != nil {
+			return fmt.Errorf("-strict: %q doesn't start with a valid CID: %w", link, err)
+		}
+		if len(segments) > 2 {
+			return fmt.Errorf("-strict: %q points below its CID, downloads start at a CID, use /ipfs/%s", link, segments[1])
+		}
+	case path.IPNSNamespace:
+		// names are keys or DNSLink domains, whether one exists only shows when resolving it
+	default:
+		return fmt.Errorf("-strict: %q is neither an /ipfs/ nor an /ipns/ path", link)
+	}
+	return nil
+}
+
+// Share link hints under -strict have to be well-formed, a bad one is an error instead of a warning.
+func checkStrictHints(input string, query string) error {
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("-strict: %q ends in ?%s, which isn't a query: %w", input, query, err)
+	}
+	for key, hints := range values {
+		switch key {
+		case expiryHintKey:
+			if _, ok := ShareExpiryHint(input); !ok || len(hints) != 1 {
+				return fmt.Errorf("-strict: the ?%s= hint of %q isn't a single RFC 3339 time", expiryHintKey, input)
+			}
+		case peerHintKey:
+			for _, hint := range hints {
+				if _, err := ParsePeerHint(hint); err != nil {
+					return fmt.Errorf("-strict: the peer hint %q of %q is invalid: %w", hint, input, err)
+				}
+			}
+		default:
+			return fmt.Errorf("-strict: %q has the query parameter %q, share links only carry ?%s= and ?%s= hints", input, key, expiryHintKey, peerHintKey)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Turns -swarm-filter values into Swarm.AddrFilters entries. A plain CIDR like 192.168.0.0/16 is never dialed. A
+// negated one like !10.8.0.0/16 allows only that range: everything outside all negated ranges is filtered, which
+// includes the public internet and the bootstrap nodes, so it is meant for private setups like a VPN subnet.
+func SwarmAddrFilters(filters []string) ([]string, error) {
+	var denied, allowed []netip.Prefix
+	for _, filter := range filters {
+		negated := strings.HasPrefix(filter, "!")
+		prefix, err := netip.ParsePrefix(strings.TrimPrefix(filter, "!"))
+		if err != nil {
+			return nil, UsageError{fmt.Errorf("invalid -swarm-filter %q: %w", filter, err)}
+		}
+		if negated {
+			allowed = append(allowed, prefix.Masked())
+		} else {
+			denied = append(denied, prefix.Masked())
+		}
+	}
+
+	// AddrFilters can only deny, so allowing a range means denying everything around it
+	if len(allowed) > 0 {
+		denied = append(denied, PrefixComplement(netip.MustParsePrefix("0.0.0.0/0"), allowed)...)
+		denied = append(denied, PrefixComplement(netip.MustParsePrefix("::/0"), allowed)...)
+	}
+
+	addrFilters := make([]string, 0, len(denied))
+	for _, prefix := range denied {
+		family := "ip4"
+		if prefix.Addr().Is6() {
+			family = "ip6"
+		}
+		addrFilters = append(addrFilters, fmt.Sprintf("/%s/%s/ipcidr/%d", family, prefix.Addr(), prefix.Bits()))
+	}
+	return addrFilters, nil
+}
+
+// Returns the smallest list of prefixes that covers space without overlapping any of the allowed prefixes.
+func PrefixComplement(space netip.Prefix, allowed []netip.Prefix) []netip.Prefix {
+	overlaps := false
+	for _, prefix := range allowed {
+		if prefix.Addr().Is4() != space.Addr().Is4() || !prefix.Overlaps(space) {
+			continue
+		}
+		if prefix.Bits() <= space.Bits() {
+			// space lies completely inside an allowed prefix
+			return nil
+		}
+		overlaps = true
+	}
+	if !overlaps {
+		return []netip.Prefix{space}
+	}
+
+	// split space into its two halves and look at each of them
+	lower := netip.PrefixFrom(space.Addr(), space.Bits()+1)
+	upperAddr := space.Addr().AsSlice()
+	upperAddr[space.Bits()/8] |= 0x80 >> (space.Bits() % 8)
+	upperIP, _ := netip.AddrFromSlice(upperAddr)
+	upper := netip.PrefixFrom(upperIP, space.Bits()+1)
+
+	return append(PrefixComplement(lower, allowed), PrefixComplement(upper, allowed)...)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// How long the phases of a run took, in the order they finished. Printed at the end with -timing. Safe for
+// concurrent use, parallel downloads record their phases each.
+type PhaseTimings struct {
+	mu     sync.Mutex
+	phases []phaseTiming
+}
+
+type phaseTiming struct {
+	name     string
+	duration time.Duration
+}
+
+var timings PhaseTimings
+
+// Records that phase took from started until now.
+func (t *PhaseTimings) Since(phase string, started time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phases = append(t.phases, phaseTiming{phase, time.Since(started)})
+}
+
+// Prints the recorded phases with -timing, phases that never finished (e.g. providing when seeding stopped early)
+// are missing.
+func (t *PhaseTimings) Print() {
+	if !*flagTiming {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintln(output.Status, "Timing:")
+	for _, phase := range t.phases {
+		fmt.Fprintf(output.Status, "  %-16s %s\n", phase.name, phase.duration.Round(time.Millisecond))
+	}
+}
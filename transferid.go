@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// The -transfer-id of this run, with auto already replaced by a UUID, or "" without one.
+var transferId string
+
+// Resolves -transfer-id and tags what fsg prints with it: Status lines and progress bars get a "[<id>] " prefix,
+// -json-progress events an "id" field. Results stay as they are, scripts read them whole. Has to run before anything
+// is printed.
+func SetupTransferId() error {
+	transferId = *flagTransferId
+	if transferId == "" {
+		return nil
+	}
+	if transferId == "auto" {
+		transferId = uuid.NewString()
+	}
+	if strings.ContainsFunc(transferId, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) {
+		return UsageError{errors.New("-transfer-id can't contain spaces or control characters, it starts every line")}
+	}
+
+	prefix := []byte("[" + transferId + "] ")
+	output.Status = &prefixWriter{w: output.Status, prefix: prefix, lineStart: true}
+	if !*flagJsonProgress {
+		output.Progress = &prefixWriter{w: output.Progress, prefix: prefix, lineStart: true}
+	}
+	return nil
+}
+
+// Puts prefix in front of every line written to w. A progress bar redraws its line after a \r, which counts as the
+// start of a line as well. The prefix is only written once the line has something in it.
+type prefixWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	prefix    []byte
+	lineStart bool
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	buf := make([]byte, 0, len(b)+len(p.prefix))
+	for _, c := range b {
+		if p.lineStart && c != '\n' && c != '\r' {
+			buf = append(buf, p.prefix...)
+			p.lineStart = false
+		}
+		buf = append(buf, c)
+		if c == '\n' || c == '\r' {
+			p.lineStart = true
+		}
+	}
+	if _, err := p.w.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+)
+
+// What PrintTree counted while walking, for the line at the end.
+type treeCounts struct {
+	dirs, files int
+	size        uint64
+}
+
+// Prints the directory hierarchy of cidStr like tree(1), with the size of every file, without downloading any file
+// data. -max-depth limits how many levels are shown, deeper directories are listed but not opened.
+func PrintTree(cidStr string) error {
+	rootCid, err := cid.Parse(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{err}
+	}
+
+	ctx, ipfsA, cancel, err := StartOrAttachIpfsNode()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	rootNode, err := ipfsA.Unixfs().Get(ctx, path.FromCid(rootCid))
+	if err != nil {
+		return fmt.Errorf("could not fetch %s: %w", rootCid, err)
+	}
+	defer rootNode.Close()
+
+	fmt.Fprintln(output.Status, rootCid)
+	var counts treeCounts
+	dir, ok := rootNode.(files.Directory)
+	if !ok {
+		if size, err := rootNode.Size(); err == nil {
+			fmt.Fprintf(output.Status, "a single file of %s, not a directory\n", FormatSize(uint64(size)))
+		}
+		return nil
+	}
+	if err := printTreeDir(dir, rootCid.String(), "", 1, &counts); err != nil {
+		return err
+	}
+	fmt.Fprintf(output.Status, "\n%d directories, %d files, %s\n", counts.dirs, counts.files, FormatSize(counts.size))
+	return nil
+}
+
+// Prints the entries of dir, which is at dirPath and depth levels below the root, behind indent and opens its
+// subdirectories until -max-depth.
+func printTreeDir(dir files.Directory, dirPath string, indent string, depth int, counts *treeCounts) error {
+	// the last entry gets another connector, so the whole listing is needed before anything is printed
+	type entry struct {
+		name string
+		node files.Node
+	}
+	var entries []entry
+	it := dir.Entries()
+	for it.Next() {
+		entries = append(entries, entry{it.Name(), it.Node()})
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("could not list %s: %w", dirPath, err)
+	}
+
+	for i, e := range entries {
+		connector, childIndent := "├── ", indent+"│   "
+		if i == len(entries)-1 {
+			connector, childIndent = "└── ", indent+"    "
+		}
+		switch node := e.node.(type) {
+		case files.Directory:
+			counts.dirs++
+			fmt.Fprintf(output.Status, "%s%s%s/\n", indent, connector, e.name)
+			if *flagMaxDepth == 0 || depth < *flagMaxDepth {
+				if err := printTreeDir(node, dirPath+"/"+e.name, childIndent, depth+1, counts); err != nil {
+					return err
+				}
+			}
+		case *files.Symlink:
+			counts.files++
+			fmt.Fprintf(output.Status, "%s%s%s -> %s\n", indent, connector, e.name, node.Target)
+		default:
+			counts.files++
+			if size, err := node.Size(); err == nil {
+				counts.size += uint64(size)
+				fmt.Fprintf(output.Status, "%s%s%s (%s)\n", indent, connector, e.name, FormatSize(uint64(size)))
+			} else {
+				fmt.Fprintf(output.Status, "%s%s%s\n", indent, connector, e.name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/kubo/core"
+	"github.com/ipfs/kubo/core/coreapi"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+)
+
+// A block of a pinned DAG that is missing from the repo or whose content doesn't hash to its CID anymore.
+type BadBlock struct {
+	Pin   cid.Cid
+	Block cid.Cid
+	Err   error
+}
+
+// Runs VerifyPins every interval until ctx is done and prints what it found. Meant for long running seeders, where
+// a disk going bad would otherwise only show when a peer gives up on a block.
+func VerifyPeriodically(ctx context.Context, node *core.IpfsNode, interval time.Duration) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+
+		started := time.Now()
+		checked, bad, err := VerifyPins(ctx, node)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			fmt.Fprintf(output.Status, "\nIntegrity check failed: %s\n", err)
+			continue
+		}
+		if len(bad) == 0 {
+			fmt.Fprintf(output.Status, "\nIntegrity check: %d blocks of the pinned content are fine (took %s)\n", checked, time.Since(started).Round(time.Millisecond))
+			continue
+		}
+		fmt.Fprintf(output.Status, "\nIntegrity check: %d of %d blocks of the pinned content are bad, import these pins again:\n", len(bad), checked)
+		for _, b := range bad {
+			fmt.Fprintf(output.Status, "  pin %s block %s: %s\n", b.Pin, b.Block, b.Err)
+		}
+	}
+}
+
+// Reads every block below the recursive pins of node from the blockstore and hashes it again. Nothing is fetched
+// from the network, a block that isn't in the repo is reported as missing. Returns how many blocks were checked.
+func VerifyPins(ctx context.Context, node *core.IpfsNode) (int, []BadBlock, error) {
+	offlineApi, err := coreapi.NewCoreAPI(node, options.Api.Offline(true))
+	if err != nil {
+		return 0, nil, err
+	}
+	pins, err := offlineApi.Pin().Ls(ctx, options.Pin.Ls.Recursive())
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not list pins: %w", err)
+	}
+	var roots []cid.Cid
+	for pin := range pins {
+		if pin.Err() != nil {
+			return 0, nil, fmt.Errorf("could not list pins: %w", pin.Err())
+		}
+		roots = append(roots, pin.Path().RootCid())
+	}
+
+	// pins often share blocks, e.g. an upload and a directory wrapping it, each block is checked once
+	checked := map[cid.Cid]bool{}
+	var bad []BadBlock
+	for _, root := range roots {
+		bad = append(bad, VerifyDag(ctx, node, offlineApi, root, checked)...)
+		if ctx.Err() != nil {
+			return 0, nil, ctx.Err()
+		}
+	}
+	return len(checked), bad, nil
+}
+
+// Checks the blocks of the DAG at root that aren't in checked yet. Below a bad block the walk stops, its links
+// can't be trusted.
+func VerifyDag(ctx context.Context, node *core.IpfsNode, offlineApi icore.CoreAPI, root cid.Cid, checked map[cid.Cid]bool) []BadBlock {
+	var bad []BadBlock
+	queue := []cid.Cid{root}
+	for i := 0; i < len(queue) && ctx.Err() == nil; i++ {
+		c := queue[i]
+		if checked[c] {
+			continue
+		}
+		checked[c] = true
+
+		if err := VerifyBlock(ctx, node, c); err != nil {
+			bad = append(bad, BadBlock{Pin: root, Block: c, Err: err})
+			continue
+		}
+		nd, err := offlineApi.Dag().Get(ctx, c)
+		if err != nil {
+			bad = append(bad, BadBlock{Pin: root, Block: c, Err: fmt.Errorf("could not decode: %w", err)})
+			continue
+		}
+		for _, link := range nd.Links() {
+			queue = append(queue, link.Cid)
+		}
+	}
+	return bad
+}
+
+// Reads the block c from the blockstore and checks that its content still hashes to c.
+func VerifyBlock(ctx context.Context, node *core.IpfsNode, c cid.Cid) error {
+	blk, err := node.Blockstore.Get(ctx, c)
+	if ipld.IsNotFound(err) {
+		return fmt.Errorf("missing from the repo")
+	}
+	if err != nil {
+		return err
+	}
+	sum, err := c.Prefix().Sum(blk.RawData())
+	if err != nil {
+		return err
+	}
+	if !sum.Equals(c) {
+		return fmt.Errorf("content hashes to %s, the block is corrupt", sum)
+	}
+	return nil
+}
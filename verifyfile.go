@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// kubo's default chunker, and the 1MiB one of its test-cids profile and of many pinning services.
+var verifyChunkers = []string{"size-262144", "size-1048576"}
+
+// One way of adding a file that -verify-file tries.
+type addVariant struct {
+	layout  string
+	chunker string
+	// like fsg shares single files, inside a directory that only holds them
+	wrapped bool
+}
+
+func (v addVariant) Options() []options.UnixfsAddOption {
+	layout := options.BalancedLayout
+	if v.layout == "trickle" {
+		layout = options.TrickleLayout
+	}
+	return []options.UnixfsAddOption{options.Unixfs.Layout(layout), options.Unixfs.Chunker(v.chunker)}
+}
+
+func (v addVariant) String() string {
+	s := fmt.Sprintf("-layout %s -chunker %s", v.layout, v.chunker)
+	if v.wrapped {
+		s += ", wrapped in a directory like fsg shares it"
+	}
+	return s
+}
+
+// Checks offline whether the file or directory at filePath has the content of cidStr, e.g. one downloaded some other
+// way. The CID of filePath depends on how it was added, so unless -layout and -chunker are given every combination
+// of the layouts and the common chunkers is tried, each for the file as it is and wrapped like fsg shares it. CID
+// version and hash function are taken from cidStr. Fails when none of them gives cidStr.
+func VerifyFile(filePath string, cidStr string) error {
+	want, err := cid.Decode(GetCidStrFromString(cidStr))
+	if err != nil {
+		return UsageError{fmt.Errorf("can't verify against %q: %w", cidStr, err)}
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	variants, err := verifyVariants(info.IsDir())
+	if err != nil {
+		return err
+	}
+
+	// a CIDv1 from `ipfs add --cid-version 1` comes with raw leaves, which CidVersion(1) turns on as well
+	versionOptions := []options.UnixfsAddOption{options.Unixfs.CidVersion(int(want.Version())), options.Unixfs.HashOnly(true)}
+	if hashCode := want.Prefix().MhType; hashCode != mh.SHA2_256 {
+		versionOptions = append(versionOptions, options.Unixfs.Hash(hashCode))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ipfsA, node, err := NewMemoryNode(ctx)
+	if err != nil {
+		return err
+	}
+	defer node.Close()
+
+	var first cid.Cid
+	for _, variant := range variants {
+		// a node is read while it is added, every try needs a new one
+		someFile, err := GetUploadEntry(filePath)
+		if err != nil {
+			return err
+		}
+		if variant.wrapped {
+			someFile = files.NewSliceDirectory([]files.DirEntry{files.FileEntry(filepath.Base(filePath), someFile)})
+		}
+		added, err := AddOffline(ctx, ipfsA, someFile, append(variant.Options(), versionOptions...)...)
+		if err != nil {
+			return err
+		}
+		if added.RootCid().Equals(want) {
+			fmt.Fprintf(output.Status, "%s matches %s (%s)\n", filePath, want, variant)
+			return nil
+		}
+		if !first.Defined() {
+			first = added.RootCid()
+		}
+	}
+	return fmt.Errorf("%s doesn't match %s, none of %d ways of adding it gives that CID (%s gives %s)", filePath, want, len(variants), variants[0], first)
+}
+
+// Returns the ways of adding the file to try, the one -layout and -chunker describe first. Only files are wrapped.
+func verifyVariants(isDir bool) ([]addVariant, error) {
+	if *flagLayout != "balanced" && *flagLayout != "trickle" {
+		return nil, UsageError{fmt.Errorf("unknown layout %q, use balanced or trickle", *flagLayout)}
+	}
+	layouts := []string{*flagLayout}
+	if !flagWasSet("layout") {
+		layouts = []string{"balanced", "trickle"}
+	}
+	chunkers := verifyChunkers
+	if *flagChunker != "" {
+		chunkers = []string{*flagChunker}
+	}
+
+	var variants []addVariant
+	for _, wrapped := range []bool{!isDir, false} {
+		for _, layout := range layouts {
+			for _, chunker := range chunkers {
+				variants = append(variants, addVariant{layout, chunker, wrapped})
+			}
+		}
+		if isDir {
+			break
+		}
+	}
+	return variants, nil
+}
+
+// Whether the flag name was given on the command line, rather than left at its default.
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
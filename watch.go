@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/ipfs/boxo/path"
+	icore "github.com/ipfs/kubo/core/coreiface"
+)
+
+// How long the watched files have to stay unchanged before they are added again. Editors and build tools write
+// several files in a row, each burst ends up as one new root.
+const watchDebounce = 2 * time.Second
+
+// Watches filePath, a directory with everything below it or a single file, and adds it again once changes have
+// settled. Every new root replaces the old one: its pin on a persistent repo and -pin-name, the announcement and with
+// -publish the IPNS name. root is the CID of the first add, it is published first. Runs until ctx is done.
+func WatchAndRepublish(ctx context.Context, ipfsA icore.CoreAPI, filePath string, root path.ImmutablePath) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(output.Status, "\ncould not watch %s: %s\n", filePath, err)
+		return
+	}
+	defer watcher.Close()
+
+	fileInfo, err := os.Stat(filePath)
+	if err == nil && fileInfo.IsDir() {
+		err = WatchTree(watcher, filePath)
+	} else if err == nil {
+		// editors often replace a file instead of writing it, a watch on the file itself would be lost then
+		err = watcher.Add(filepath.Dir(filePath))
+	}
+	if err != nil {
+		fmt.Fprintf(output.Status, "\ncould not watch %s: %s\n", filePath, err)
+		return
+	}
+	fmt.Fprintf(output.Status, "Watching %s for changes\n", filePath)
+
+	if *flagPublish {
+		if err := PublishName(ctx, ipfsA, root); err != nil && ctx.Err() == nil {
+			fmt.Fprintf(output.Status, "\n%s\n", err)
+		}
+	}
+
+	// a nil channel never fires, the timer only runs while changes are waiting
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-watcher.Errors:
+			fmt.Fprintf(output.Status, "\nerror watching %s: %s\n", filePath, err)
+		case event := <-watcher.Events:
+			if !fileInfo.IsDir() && filepath.Clean(event.Name) != filepath.Clean(filePath) {
+				continue
+			}
+			if !*flagIncludeHidden && strings.HasPrefix(filepath.Base(event.Name), ".") {
+				continue
+			}
+			// directories created later are watched too, their content is part of the next add
+			if event.Has(fsnotify.Create) && fileInfo.IsDir() {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					WatchTree(watcher, event.Name)
+				}
+			}
+			settled = time.After(watchDebounce)
+		case <-settled:
+			settled = nil
+			newRoot, err := AddChanges(ctx, ipfsA, filePath, root)
+			if err != nil {
+				if ctx.Err() == nil {
+					fmt.Fprintf(output.Status, "\ncould not add the changes of %s: %s\n", filePath, err)
+				}
+				continue
+			}
+			if newRoot.RootCid() == root.RootCid() {
+				continue
+			}
+			root = newRoot
+			if *flagPublish {
+				if err := PublishName(ctx, ipfsA, root); err != nil && ctx.Err() == nil {
+					fmt.Fprintf(output.Status, "\n%s\n", err)
+				}
+			}
+		}
+	}
+}
+
+// Adds every directory of the tree at dirPath to watcher, fsnotify doesn't watch recursively. Hidden directories are
+// left out like the add leaves them out.
+func WatchTree(watcher *fsnotify.Watcher, dirPath string) error {
+	return filepath.WalkDir(dirPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != dirPath && !*flagIncludeHidden && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return watcher.Add(p)
+	})
+}
+
+// Adds filePath again with the upload options and, when the root changed, moves the pin and -pin-name of a
+// persistent repo over from oldRoot and announces the new root.
+func AddChanges(ctx context.Context, ipfsA icore.CoreAPI, filePath string, oldRoot path.ImmutablePath) (path.ImmutablePath, error) {
+	someFile, err := GetUploadNode(filePath)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	addOptions, err := UnixfsAddOptions()
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	newRoot, err := ipfsA.Unixfs().Add(ctx, someFile, addOptions...)
+	if err != nil {
+		return path.ImmutablePath{}, err
+	}
+	if newRoot.RootCid() == oldRoot.RootCid() {
+		return newRoot, nil
+	}
+
+	if *flagRepo != "" {
+		// the old version isn't needed anymore, its blocks are left for the repo GC
+		if err := ipfsA.Pin().Update(ctx, oldRoot, newRoot); err != nil {
+			return path.ImmutablePath{}, fmt.Errorf("could not move the pin to %s: %w", newRoot.RootCid(), err)
+		}
+		if *flagPinName != "" {
+			if err := RelabelPin(*flagRepo, *flagPinName, newRoot.RootCid()); err != nil {
+				return path.ImmutablePath{}, err
+			}
+		}
+	}
+	fmt.Fprintf(output.Status, "\n%s changed, share this CID with your friend:\n%s\n", filePath, newRoot)
+
+	if routingOff, _ := ContentRoutingOff(); !routingOff {
+		go func() {
+			err := ProvideDag(ctx, ipfsA, newRoot.RootCid(), &ProvideProgress{})
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nerror providing blocks of %s: %s\n", newRoot.RootCid(), err)
+			}
+		}()
+	}
+	return newRoot, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/boxo/bitswap"
+	"github.com/ipfs/boxo/path"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/kubo/core"
+	icore "github.com/ipfs/kubo/core/coreiface"
+	"github.com/ipfs/kubo/core/coreiface/options"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Watches the byte counter of a running download and, whenever it didn't move for stallTimeout, looks up the
+// providers of p again and dials them. Bitswap only asks peers it is connected to, so a dropped provider otherwise
+// leaves the download hanging without any output. Returns when ctx is done.
+func WatchForStalls(ctx context.Context, ipfsA icore.CoreAPI, p path.Path, written *atomic.Int64, stallTimeout time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	lastWritten := written.Load()
+	lastProgress := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if current := written.Load(); current != lastWritten {
+			lastWritten = current
+			lastProgress = time.Now()
+			continue
+		}
+		if time.Since(lastProgress) < stallTimeout {
+			continue
+		}
+
+		fmt.Fprintf(output.Status, "\nNo data received for %s, searching for providers again\n", stallTimeout)
+		connected, err := ReconnectProviders(ctx, ipfsA, p, stallTimeout)
+		if err != nil && ctx.Err() == nil {
+			fmt.Fprintf(output.Status, "Provider search failed: %s\n", err)
+		} else if ctx.Err() == nil {
+			fmt.Fprintf(output.Status, "Connected to %d provider(s)\n", connected)
+		}
+		// give the new connections a full timeout before trying again
+		lastProgress = time.Now()
+	}
+}
+
+// Finds up to ProvidersLimit providers of p and connects to them, returns how many connections succeeded.
+func ReconnectProviders(ctx context.Context, ipfsA icore.CoreAPI, p path.Path, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	providers, err := ipfsA.Dht().FindProviders(ctx, p, options.Dht.NumProviders(ProvidersLimit()))
+	if err != nil {
+		return 0, err
+	}
+
+	connected := 0
+	for provider := range providers {
+		if err := ConnectPeer(ctx, ipfsA, provider); err == nil {
+			connected += 1
+		}
+	}
+	return connected, nil
+}
+
+// Watches the wantlist of node and, for every block that was wanted longer than blockTimeout, looks up providers of
+// that block and dials the ones not connected yet, so bitswap asks them as well. One slow peer holding a block back
+// otherwise bottlenecks a download that is fine apart from it. Returns when ctx is done.
+func WatchBlocks(ctx context.Context, ipfsA icore.CoreAPI, node *core.IpfsNode, blockTimeout time.Duration) {
+	bs, ok := node.Exchange.(*bitswap.Bitswap)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	wantedSince := map[cid.Cid]time.Time{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		wanted := map[cid.Cid]bool{}
+		for _, c := range bs.GetWantlist() {
+			wanted[c] = true
+			if _, ok := wantedSince[c]; !ok {
+				wantedSince[c] = now
+			}
+		}
+		for c, since := range wantedSince {
+			if !wanted[c] {
+				delete(wantedSince, c)
+				continue
+			}
+			if now.Sub(since) < blockTimeout {
+				continue
+			}
+
+			connected, err := ConnectNewProviders(ctx, ipfsA, c, blockTimeout)
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nBlock %s took longer than %s, provider search failed: %s\n", c, blockTimeout, err)
+			} else if ctx.Err() == nil {
+				fmt.Fprintf(output.Status, "\nBlock %s took longer than %s, asked %d more provider(s)\n", c, blockTimeout, connected)
+			}
+			// give the new providers a full timeout before searching again
+			wantedSince[c] = time.Now()
+		}
+	}
+}
+
+// Finds up to ProvidersLimit providers of the block c and connects to those we aren't connected to yet, returns how
+// many connections succeeded.
+func ConnectNewProviders(ctx context.Context, ipfsA icore.CoreAPI, c cid.Cid, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	peers, err := ipfsA.Swarm().Peers(ctx)
+	if err != nil {
+		return 0, err
+	}
+	alreadyConnected := map[peer.ID]bool{}
+	for _, p := range peers {
+		alreadyConnected[p.ID()] = true
+	}
+
+	providers, err := ipfsA.Dht().FindProviders(ctx, path.FromCid(c), options.Dht.NumProviders(ProvidersLimit()))
+	if err != nil {
+		return 0, err
+	}
+
+	connected := 0
+	for provider := range providers {
+		if alreadyConnected[provider.ID] {
+			continue
+		}
+		if err := ConnectPeer(ctx, ipfsA, provider); err == nil {
+			connected += 1
+		}
+	}
+	return connected, nil
+}